@@ -268,6 +268,24 @@ var queries = [...]benchQuery{
 		`,
 		args: []interface{}{10, 100, 1000, 15},
 	},
+
+	// 1. Join of two tables with many columns.
+	// 2. Derived table that projects every column, most of which are unused.
+	// 3. Column pruning through projections, filters and joins.
+	{
+		name: "tpcc-prune-cols",
+		query: `
+			SELECT c_last, total
+			FROM (
+				SELECT *, ol_amount * ol_quantity AS total
+				FROM customer
+				JOIN order_line
+				ON c_w_id = ol_w_id AND c_d_id = ol_d_id AND c_id = ol_o_id
+			)
+			WHERE c_w_id = $1 AND c_d_id = $2
+		`,
+		args: []interface{}{10, 100},
+	},
 }
 
 func init() {
@@ -17,6 +17,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/sql/opt/cat"
 	"github.com/cockroachdb/cockroach/pkg/sql/opt/props"
 	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/sql/types"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/errors"
 )
@@ -90,6 +91,7 @@ func (m *Memo) CheckExpr(e opt.Expr) {
 				t.Input.Relational().OutputCols.Difference(t.Passthrough),
 			))
 		}
+		var synthesized opt.ColSet
 		for _, item := range t.Projections {
 			// Check that column id is set.
 			if item.Col == 0 {
@@ -102,6 +104,13 @@ func (m *Memo) CheckExpr(e opt.Expr) {
 					"both passthrough and synthesized have column %d", log.Safe(item.Col)))
 			}
 
+			// Check that column is not synthesized more than once.
+			if synthesized.Contains(item.Col) {
+				panic(errors.AssertionFailedf(
+					"column %d is synthesized more than once", log.Safe(item.Col)))
+			}
+			synthesized.Add(item.Col)
+
 			// Check that columns aren't passed through in projection expressions.
 			if v, ok := item.Element.(*VariableExpr); ok {
 				if v.Col == item.Col {
@@ -293,7 +302,16 @@ func (m *Memo) CheckExpr(e opt.Expr) {
 			panic(errors.AssertionFailedf("NULL values should always use NullExpr, not ConstExpr"))
 		}
 
+	case *NullExpr:
+		if t.Typ == nil {
+			panic(errors.AssertionFailedf("NullExpr must have a type"))
+		}
+
 	default:
+		if opt.IsComparisonOp(e) || opt.IsBinaryOp(e) {
+			checkOperandTypes(e.(opt.ScalarExpr))
+		}
+
 		if opt.IsJoinOp(e) {
 			left := e.Child(0).(RelExpr)
 			right := e.Child(1).(RelExpr)
@@ -323,6 +341,49 @@ func (m *Memo) CheckExpr(e opt.Expr) {
 	}
 }
 
+// CheckDynamicOperands checks that the given operands match the kinds of
+// operands expected by the given operator, so that a bad call to the factory's
+// DynamicConstruct method fails with a useful message rather than a failed
+// type assertion deep inside the generated code. Operators that cannot be
+// constructed dynamically are left for DynamicConstruct to reject.
+func (m *Memo) CheckDynamicOperands(op opt.Operator, args []interface{}) {
+	if m.disableCheckExpr {
+		return
+	}
+
+	kinds := opt.OperandKinds(op)
+	if kinds == nil {
+		return
+	}
+	if len(args) != len(kinds) {
+		panic(errors.AssertionFailedf(
+			"%s expects %d operands, but got %d", log.Safe(op), len(kinds), len(args),
+		))
+	}
+	for i, arg := range args {
+		var ok bool
+		switch kinds[i] {
+		case opt.RelationalOperand:
+			_, ok = arg.(RelExpr)
+		case opt.ScalarOperand:
+			e, isScalar := arg.(opt.ScalarExpr)
+			ok = isScalar && !opt.IsListOp(e)
+		case opt.ListOperand:
+			e, isExpr := arg.(opt.Expr)
+			ok = isExpr && opt.IsListOp(e)
+		case opt.PrivateOperand:
+			_, isExpr := arg.(opt.Expr)
+			ok = arg != nil && !isExpr
+		}
+		if !ok {
+			panic(errors.AssertionFailedf(
+				"operand %d of %s must be a %s operand, but got %T",
+				i, log.Safe(op), log.Safe(kinds[i]), arg,
+			))
+		}
+	}
+}
+
 func (m *Memo) checkColListLen(colList opt.OptionalColList, expectedLen int, listName string) {
 	if len(colList) != expectedLen {
 		panic(errors.AssertionFailedf("column list %s expected length = %d, actual length = %d",
@@ -350,6 +411,15 @@ func checkExprOrdering(e opt.Expr) {
 	// their input.
 	var ordering props.OrderingChoice
 	switch t := e.Private().(type) {
+	case *SubqueryPrivate:
+		// Subquery orderings must be canonical so that equivalent orderings are
+		// interned identically.
+		if !t.Ordering.IsCanonical() {
+			panic(errors.AssertionFailedf(
+				"subquery ordering %v is not canonical (op: %s)", log.Safe(t.Ordering), log.Safe(e.Op()),
+			))
+		}
+		return
 	case *props.OrderingChoice:
 		ordering = *t
 	case *OrdinalityPrivate:
@@ -367,6 +437,34 @@ func checkExprOrdering(e opt.Expr) {
 	}
 }
 
+// checkOperandTypes ensures that the operands of a binary or comparison
+// operator have types that match one of the operator's overloads. A rule that
+// rewrites an operand without preserving its type can otherwise produce an
+// expression that only fails once it is executed.
+func checkOperandTypes(e opt.ScalarExpr) {
+	leftType := e.Child(0).(opt.ScalarExpr).DataType()
+	rightType := e.Child(1).(opt.ScalarExpr).DataType()
+	// Two NULL operands are allowed even when there is no overload for the
+	// operator (e.g. NULL = NULL or NULL + NULL), since the expression folds to
+	// NULL.
+	if leftType.Family() == types.UnknownFamily && rightType.Family() == types.UnknownFamily {
+		return
+	}
+	if opt.IsComparisonOp(e) {
+		if _, _, _, ok := FindComparisonOverload(e.Op(), leftType, rightType); !ok {
+			panic(errors.AssertionFailedf(
+				"comparison overload not found (%s, %s, %s)", log.Safe(e.Op()), leftType, rightType,
+			))
+		}
+		return
+	}
+	if !BinaryOverloadExists(e.Op(), leftType, rightType) {
+		panic(errors.AssertionFailedf(
+			"binary overload not found (%s, %s, %s)", log.Safe(e.Op()), leftType, rightType,
+		))
+	}
+}
+
 func checkFilters(filters FiltersExpr) {
 	for _, item := range filters {
 		if item.Condition.Op() == opt.RangeOp {
@@ -17,3 +17,7 @@ import "github.com/cockroachdb/cockroach/pkg/sql/opt"
 // CheckExpr is a no-op in non-test builds.
 func (m *Memo) CheckExpr(e opt.Expr) {
 }
+
+// CheckDynamicOperands is a no-op in non-test builds.
+func (m *Memo) CheckDynamicOperands(op opt.Operator, args []interface{}) {
+}
@@ -158,6 +158,21 @@ var EmptyTuple = &TupleExpr{Typ: types.EmptyTuple}
 //
 var ScalarListWithEmptyTuple = ScalarListExpr{EmptyTuple}
 
+// Equals returns true if n and other contain the same scalar expressions in
+// the same order. Since expressions are interned, two lists that are equal in
+// this sense are interned as the same list.
+func (n ScalarListExpr) Equals(other ScalarListExpr) bool {
+	if len(n) != len(other) {
+		return false
+	}
+	for i := range n {
+		if n[i] != other[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // EmptyGroupingPrivate is a global instance of a GroupingPrivate that has no
 // grouping columns and no ordering.
 var EmptyGroupingPrivate = &GroupingPrivate{}
@@ -201,6 +216,20 @@ func (n FiltersExpr) OuterCols() opt.ColSet {
 	return colSet
 }
 
+// Equals returns true if n and other contain the same conditions in the same
+// order. See ScalarListExpr.Equals.
+func (n FiltersExpr) Equals(other FiltersExpr) bool {
+	if len(n) != len(other) {
+		return false
+	}
+	for i := range n {
+		if n[i].Condition != other[i].Condition {
+			return false
+		}
+	}
+	return true
+}
+
 // Sort sorts the FilterItems in n by the IDs of the expression.
 func (n *FiltersExpr) Sort() {
 	sort.Slice(*n, func(i, j int) bool {
@@ -268,6 +297,16 @@ func (n FiltersExpr) Difference(other FiltersExpr) FiltersExpr {
 	return newFilters
 }
 
+// OutputCols returns the set of columns constructed by the Projections
+// expression.
+func (n ProjectionsExpr) OutputCols() opt.ColSet {
+	var colSet opt.ColSet
+	for i := range n {
+		colSet.Add(n[i].Col)
+	}
+	return colSet
+}
+
 // OutputCols returns the set of columns constructed by the Aggregations
 // expression.
 func (n AggregationsExpr) OutputCols() opt.ColSet {
@@ -19,6 +19,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
 	"github.com/cockroachdb/cockroach/pkg/sql/opt"
 	"github.com/cockroachdb/cockroach/pkg/sql/opt/memo"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/norm"
 	"github.com/cockroachdb/cockroach/pkg/sql/opt/optbuilder"
 	"github.com/cockroachdb/cockroach/pkg/sql/opt/testutils"
 	"github.com/cockroachdb/cockroach/pkg/sql/opt/testutils/opttester"
@@ -27,6 +28,9 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/sql/parser"
 	_ "github.com/cockroachdb/cockroach/pkg/sql/sem/builtins"
 	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/sql/types"
+	"github.com/cockroachdb/cockroach/pkg/testutils/skip"
+	"github.com/cockroachdb/cockroach/pkg/util"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/datadriven"
 )
@@ -104,3 +108,152 @@ func TestExprIsNeverNull(t *testing.T) {
 		})
 	})
 }
+
+func TestCheckExprOperandTypes(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	if !util.CrdbTestBuild {
+		skip.IgnoreLint(t, "CheckExpr is only run in crdb_test builds")
+	}
+
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+	var f norm.Factory
+	f.Init(&evalCtx, nil /* catalog */)
+	f.DisableOptimizations()
+
+	one := f.ConstructConstVal(tree.NewDInt(1), types.Int)
+	str := f.ConstructConstVal(tree.NewDString("foo"), types.String)
+
+	// A well-typed comparison passes the check, as does a comparison between
+	// two NULL values.
+	f.ConstructEq(one, one)
+	f.ConstructEq(memo.NullSingleton, memo.NullSingleton)
+
+	// The same applies to binary operators, including those with untyped
+	// placeholder operands.
+	f.ConstructPlus(one, one)
+	f.ConstructPlus(memo.NullSingleton, memo.NullSingleton)
+	placeholder, err := tree.NewPlaceholder("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.ConstructPlus(f.ConstructPlaceholder(placeholder), memo.NullSingleton)
+
+	// Comparing or adding an INT and a STRING has no overload, which indicates
+	// that a rule produced a malformed expression.
+	expectPanic := func(expected string, construct func()) {
+		t.Helper()
+		defer func() {
+			r := recover()
+			if r == nil {
+				t.Fatal("expected CheckExpr to panic")
+			}
+			if err, ok := r.(error); !ok || !strings.Contains(err.Error(), expected) {
+				t.Fatalf("unexpected panic: %v", r)
+			}
+		}()
+		construct()
+	}
+	expectPanic("comparison overload not found", func() { f.ConstructEq(one, str) })
+	expectPanic("binary overload not found", func() { f.ConstructPlus(one, str) })
+}
+
+func TestCheckDynamicOperands(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	if !util.CrdbTestBuild {
+		skip.IgnoreLint(t, "operands are only checked in crdb_test builds")
+	}
+
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+	var f norm.Factory
+	f.Init(&evalCtx, nil /* catalog */)
+	f.DisableOptimizations()
+
+	one := f.ConstructConstVal(tree.NewDInt(1), types.Int)
+	two := f.ConstructConstVal(tree.NewDInt(2), types.Int)
+
+	// Well-formed operands pass the check.
+	if e := f.DynamicConstruct(opt.PlusOp, one, two); e.Op() != opt.PlusOp {
+		t.Fatalf("expected Plus, got %s", e.Op())
+	}
+
+	testCases := []struct {
+		op       opt.Operator
+		args     []interface{}
+		expected string
+	}{
+		{
+			// Too few operands.
+			op:       opt.PlusOp,
+			args:     []interface{}{one},
+			expected: "plus expects 2 operands, but got 1",
+		},
+		{
+			// A private in a child slot.
+			op:       opt.NotOp,
+			args:     []interface{}{&memo.ScanPrivate{}},
+			expected: "operand 0 of not must be a scalar operand, but got *memo.ScanPrivate",
+		},
+		{
+			// A scalar in a private slot.
+			op:       opt.VariableOp,
+			args:     []interface{}{one},
+			expected: "operand 0 of variable must be a private operand, but got *memo.ConstExpr",
+		},
+		{
+			// A scalar in a relational slot.
+			op:       opt.SelectOp,
+			args:     []interface{}{one, &memo.TrueFilter},
+			expected: "operand 0 of select must be a relational operand, but got *memo.ConstExpr",
+		},
+	}
+
+	for _, tc := range testCases {
+		func() {
+			defer func() {
+				r := recover()
+				if r == nil {
+					t.Fatalf("expected %s to panic", tc.op)
+				}
+				if err, ok := r.(error); !ok || !strings.Contains(err.Error(), tc.expected) {
+					t.Fatalf("expected %q, got %v", tc.expected, r)
+				}
+			}()
+			f.DynamicConstruct(tc.op, tc.args...)
+		}()
+	}
+}
+
+func TestListEquals(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+	var f norm.Factory
+	f.Init(&evalCtx, nil /* catalog */)
+	f.DisableOptimizations()
+
+	one := f.ConstructConstVal(tree.NewDInt(1), types.Int)
+	two := f.ConstructConstVal(tree.NewDInt(2), types.Int)
+
+	list := memo.ScalarListExpr{one, two}
+	if !list.Equals(memo.ScalarListExpr{one, two}) {
+		t.Errorf("expected lists with the same elements to be equal")
+	}
+	if list.Equals(memo.ScalarListExpr{two, one}) {
+		t.Errorf("expected lists with differently ordered elements to differ")
+	}
+	if list.Equals(memo.ScalarListExpr{one}) {
+		t.Errorf("expected lists of different lengths to differ")
+	}
+
+	eq := f.ConstructEq(one, two)
+	lt := f.ConstructLt(one, two)
+	filters := memo.FiltersExpr{f.ConstructFiltersItem(eq), f.ConstructFiltersItem(lt)}
+	if !filters.Equals(memo.FiltersExpr{f.ConstructFiltersItem(eq), f.ConstructFiltersItem(lt)}) {
+		t.Errorf("expected filters with the same conditions to be equal")
+	}
+	if filters.Equals(memo.FiltersExpr{f.ConstructFiltersItem(lt), f.ConstructFiltersItem(eq)}) {
+		t.Errorf("expected filters with differently ordered conditions to differ")
+	}
+}
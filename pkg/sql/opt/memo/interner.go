@@ -102,6 +102,12 @@ func (in *interner) Count() int {
 	return in.cache.Count()
 }
 
+// Collisions returns the number of interned expressions whose hash value
+// collided with that of a different, previously interned expression.
+func (in *interner) Collisions() int {
+	return in.cache.Collisions()
+}
+
 var physPropsType = reflect.TypeOf((*physical.Required)(nil))
 var physPropsTypePtr = uint64(reflect.ValueOf(physPropsType).Pointer())
 
@@ -161,6 +167,10 @@ type internCache struct {
 
 	// prev stores the cache entry last fetched from the map by the Next method.
 	prev cacheEntry
+
+	// collisions counts the items that were added to an existing collision
+	// list. See Collisions.
+	collisions int
 }
 
 // cacheEntry is the Go map value. In case of hash value collisions it functions
@@ -185,6 +195,14 @@ func (c *internCache) Count() int {
 	return len(c.cache)
 }
 
+// Collisions returns the number of items that were added to the cache with the
+// same hash value as an existing, non-equal item. Since the equality of items
+// with the same hash value is always tested, collisions only affect
+// performance, not correctness; a high count suggests a weak hash function.
+func (c *internCache) Collisions() int {
+	return c.collisions
+}
+
 // Start prepares to look up an item in the cache by its hash value. It must be
 // called before Next.
 func (c *internCache) Start(hash internHash) {
@@ -235,6 +253,7 @@ func (c *internCache) Add(item interface{}) {
 	// There was a collision, so re-hash the item and link it to the existing
 	// item. Loop until the generated random hash value doesn't collide with any
 	// existing item.
+	c.collisions++
 	for {
 		// Using global rand is OK, since collisions of 64-bit random values should
 		// virtually never happen, so there won't be contention.
@@ -1014,27 +1033,11 @@ func (h *hasher) IsScalarExprEqual(l, r opt.ScalarExpr) bool {
 }
 
 func (h *hasher) IsScalarListExprEqual(l, r ScalarListExpr) bool {
-	if len(l) != len(r) {
-		return false
-	}
-	for i := range l {
-		if l[i] != r[i] {
-			return false
-		}
-	}
-	return true
+	return l.Equals(r)
 }
 
 func (h *hasher) IsFiltersExprEqual(l, r FiltersExpr) bool {
-	if len(l) != len(r) {
-		return false
-	}
-	for i := range l {
-		if l[i].Condition != r[i].Condition {
-			return false
-		}
-	}
-	return true
+	return l.Equals(r)
 }
 
 func (h *hasher) IsProjectionsExprEqual(l, r ProjectionsExpr) bool {
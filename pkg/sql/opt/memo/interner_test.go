@@ -666,6 +666,14 @@ func TestInternerCollision(t *testing.T) {
 	if in.cache.Next() {
 		t.Errorf("expected no more colliding items in cache")
 	}
+
+	// Only "bar" and "baz" collided with an existing item.
+	if in.Count() != 4 {
+		t.Errorf("expected 4 items in cache, got %d", in.Count())
+	}
+	if in.Collisions() != 2 {
+		t.Errorf("expected 2 collisions, got %d", in.Collisions())
+	}
 }
 
 func BenchmarkEncodeDatum(b *testing.B) {
@@ -226,8 +226,14 @@ func (b *logicalPropsBuilder) buildSelectProps(sel *SelectExpr, rel *props.Relat
 	//
 	//   SELECT y FROM xy WHERE y=5
 	//
-	// "y" cannot be null because the SQL equality operator rejects nulls.
+	// "y" cannot be null because the SQL equality operator rejects nulls. The
+	// same holds for columns of expressions that transmit nulls:
+	//
+	//   SELECT y FROM xy WHERE x+y > 5
+	//
+	// Neither "x" nor "y" can be null (see nullRejectedCols).
 	rel.NotNullCols = b.rejectNullCols(sel.Filters)
+	rel.NotNullCols.UnionWith(nullRejectedCols(sel.Filters))
 	rel.NotNullCols.UnionWith(inputProps.NotNullCols)
 	rel.NotNullCols.IntersectionWith(rel.OutputCols)
 
@@ -1870,6 +1876,71 @@ func (b *logicalPropsBuilder) rejectNullCols(filters FiltersExpr) opt.ColSet {
 	return NullColsRejectedByFilter(b.evalCtx, filters)
 }
 
+// nullRejectedCols returns the set of columns that are inferred to be not-null
+// from the structure of the filter conditions. It complements rejectNullCols,
+// which relies on the constraints derived for each condition, by also
+// understanding comparisons and IS NOT NULL tests of expressions that transmit
+// nulls, for which no constraint is built:
+//
+//   SELECT * FROM ab WHERE a + b > 5
+//
+// Neither "a" nor "b" can be null, since the sum would then be null, and the
+// comparison would not be true.
+func nullRejectedCols(filters FiltersExpr) opt.ColSet {
+	var notNullCols opt.ColSet
+	for i := range filters {
+		notNullCols.UnionWith(conditionNullRejectedCols(filters[i].Condition))
+	}
+	return notNullCols
+}
+
+// conditionNullRejectedCols returns the set of columns for which a NULL value
+// prevents the given boolean condition from evaluating to true. A conjunction
+// rejects the nulls rejected by either of its operands, while a disjunction
+// only rejects the nulls rejected by both of its operands.
+func conditionNullRejectedCols(cond opt.ScalarExpr) opt.ColSet {
+	switch t := cond.(type) {
+	case *AndExpr:
+		return conditionNullRejectedCols(t.Left).Union(conditionNullRejectedCols(t.Right))
+
+	case *OrExpr:
+		return conditionNullRejectedCols(t.Left).Intersection(conditionNullRejectedCols(t.Right))
+
+	case *RangeExpr:
+		return conditionNullRejectedCols(t.And)
+
+	case *IsNotExpr:
+		if t.Right.Op() == opt.NullOp {
+			return nullTransmittingCols(t.Left)
+		}
+		return opt.ColSet{}
+	}
+
+	if opt.BoolOperatorRequiresNotNullArgs(cond.Op()) {
+		left := nullTransmittingCols(cond.Child(0).(opt.ScalarExpr))
+		return left.Union(nullTransmittingCols(cond.Child(1).(opt.ScalarExpr)))
+	}
+	return opt.ColSet{}
+}
+
+// nullTransmittingCols returns the set of columns for which a NULL value causes
+// the given scalar expression to evaluate to NULL. This is the case for the
+// columns that are reachable from the expression through an unbroken chain of
+// operators that transmit nulls (see opt.ScalarOperatorTransmitsNulls).
+func nullTransmittingCols(e opt.ScalarExpr) opt.ColSet {
+	if v, ok := e.(*VariableExpr); ok {
+		return opt.MakeColSet(v.Col)
+	}
+	var cols opt.ColSet
+	if !opt.ScalarOperatorTransmitsNulls(e.Op()) {
+		return cols
+	}
+	for i, n := 0, e.ChildCount(); i < n; i++ {
+		cols.UnionWith(nullTransmittingCols(e.Child(i).(opt.ScalarExpr)))
+	}
+	return cols
+}
+
 // addFiltersToFuncDep returns the union of all functional dependencies from
 // each condition in the filters.
 func (b *logicalPropsBuilder) addFiltersToFuncDep(filters FiltersExpr, fdset *props.FuncDepSet) {
@@ -2039,8 +2110,7 @@ func ensureInputPropsForIndex(
 	sb *statisticsBuilder,
 ) {
 	if relProps.OutputCols.Empty() {
-		relProps.OutputCols = md.TableMeta(tabID).IndexColumns(indexOrd)
-		relProps.OutputCols.IntersectionWith(outputCols)
+		relProps.OutputCols = md.TableMeta(tabID).IndexColumns(indexOrd).Intersection(outputCols)
 		relProps.NotNullCols = tableNotNullCols(md, tabID)
 		relProps.NotNullCols.IntersectionWith(relProps.OutputCols)
 		relProps.Cardinality = props.AnyCardinality
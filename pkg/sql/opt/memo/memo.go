@@ -129,6 +129,10 @@ type Memo struct {
 	// memEstimate is the approximate memory usage of the memo, in bytes.
 	memEstimate int64
 
+	// stats counts the expressions and properties added to the memo. See the
+	// Stats method.
+	stats MemoStats
+
 	// The following are selected fields from SessionData which can affect
 	// planning. We need to cross-check these before reusing a cached memo.
 	reorderJoinsLimit       int
@@ -204,6 +208,44 @@ func (m *Memo) MemoryEstimate() int64 {
 	return m.memEstimate * 2
 }
 
+// MemoStats describes the size of a memo. See Memo.Stats.
+type MemoStats struct {
+	// Groups is the number of relational memo groups.
+	Groups int
+
+	// RelExprs is the number of relational expressions in the memo, including
+	// the alternate expressions added to existing groups during exploration.
+	RelExprs int
+
+	// ScalarExprs is the number of interned scalar expressions. Scalar lists,
+	// like FiltersExpr and ProjectionsExpr, and operator privates are stored
+	// inline in their parent expressions, so they are not counted separately.
+	ScalarExprs int
+
+	// PhysicalProps is the number of distinct physical properties that have
+	// been interned.
+	PhysicalProps int
+
+	// HashCollisions is the number of interned expressions and physical
+	// properties whose hash value collided with that of a different one that
+	// was interned earlier. Colliding values are still distinguished by a full
+	// equality check, so this only indicates the quality of the hash function.
+	HashCollisions int
+
+	// MemoryEstimate is the value returned by Memo.MemoryEstimate.
+	MemoryEstimate int64
+}
+
+// Stats returns statistics about the size of the memo, which can be useful when
+// diagnosing queries that produce an unexpectedly large memo. The counters are
+// maintained as expressions are added, so this is cheap to call.
+func (m *Memo) Stats() MemoStats {
+	stats := m.stats
+	stats.HashCollisions = m.interner.Collisions()
+	stats.MemoryEstimate = m.MemoryEstimate()
+	return stats
+}
+
 // Metadata returns the metadata instance associated with the memo.
 func (m *Memo) Metadata() *opt.Metadata {
 	return &m.metadata
@@ -308,7 +350,12 @@ func (m *Memo) InternPhysicalProps(phys *physical.Required) *physical.Required {
 	if !phys.Defined() {
 		return physical.MinRequired
 	}
-	return m.interner.InternPhysicalProps(phys)
+	count := m.interner.Count()
+	interned := m.interner.InternPhysicalProps(phys)
+	if m.interner.Count() != count {
+		m.stats.PhysicalProps++
+	}
+	return interned
 }
 
 // SetBestProps updates the physical properties, provided ordering, and cost of
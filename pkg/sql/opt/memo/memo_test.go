@@ -97,6 +97,36 @@ func TestCompositeSensitive(t *testing.T) {
 	})
 }
 
+// TestFormatSExpr runs data-driven testcases of the form
+//   <command> [<args>]...
+//   <SQL statement or expression>
+//   ----
+//   <expected results>
+//
+// See OptTester.Handle for supported commands. In addition to those, we
+// support:
+//
+//  - sexpr
+//
+//    Builds and normalizes the SQL query, and then formats the result using
+//    memo.FormatSExpr.
+//
+func TestFormatSExpr(t *testing.T) {
+	catalog := testcat.New()
+	datadriven.RunTest(t, "testdata/sexpr", func(t *testing.T, d *datadriven.TestData) string {
+		tester := opttester.New(catalog, d.Input)
+		if d.Cmd != "sexpr" {
+			return tester.RunCommand(t, d)
+		}
+		e, err := tester.OptNorm()
+		if err != nil {
+			d.Fatalf(t, "%v", err)
+		}
+		md := e.(memo.RelExpr).Memo().Metadata()
+		return memo.FormatSExpr(e, md) + "\n"
+	})
+}
+
 func TestMemoInit(t *testing.T) {
 	catalog := testcat.New()
 	_, err := catalog.ExecuteDDL("CREATE TABLE abc (a INT PRIMARY KEY, b INT, c STRING, INDEX (c))")
@@ -116,6 +146,9 @@ func TestMemoInit(t *testing.T) {
 	if o.Memo().MemoryEstimate() != 0 {
 		t.Fatal("memory estimate should be 0")
 	}
+	if o.Memo().Stats() != (memo.MemoStats{}) {
+		t.Fatal("memo stats should be empty")
+	}
 	if o.Memo().RootExpr() != nil {
 		t.Fatal("root expression should be nil")
 	}
@@ -0,0 +1,166 @@
+// Copyright 2021 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package memo
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/cockroachdb/cockroach/pkg/sql/opt"
+)
+
+// FormatSExpr returns a single-line, optgen-style s-expression for the given
+// expression tree, similar to the ones used in the comments of the normalization
+// rules. For example:
+//
+//   (Select (Scan a) [(Eq (Variable a.x) (Const 1))])
+//
+// Operator names are printed in their optgen (camel case) form, list operators
+// are printed in square brackets, and list items other than projections and
+// aggregations are elided in favor of their first child. As in optgen, privates
+// follow the children of an expression. Only the privates that identify an
+// expression in rule comments (columns, constants, tables, function names and
+// cast types) are printed, along with the columns that an expression produces
+// or passes through: the output column of each projection and aggregation, the
+// passthrough columns of a Project and the grouping columns of a grouping
+// operator. Columns are resolved to table-qualified names using the given
+// metadata; the columns that an expression produces or passes through are also
+// printed with their ids, since synthesized columns often share a name. For
+// example:
+//
+//   (DistinctOn (Scan a) [] (GroupingCols a.y:2))
+//
+// Unlike FormatExpr, FormatSExpr does not print any logical or physical
+// properties, and its output is deterministic for a given expression tree.
+func FormatSExpr(e opt.Expr, md *opt.Metadata) string {
+	f := sexprFmtCtx{md: md}
+	f.formatExpr(e)
+	return f.buf.String()
+}
+
+// sexprFmtCtx is the context used by FormatSExpr.
+type sexprFmtCtx struct {
+	buf bytes.Buffer
+	md  *opt.Metadata
+}
+
+func (f *sexprFmtCtx) formatExpr(e opt.Expr) {
+	if opt.IsListItemOp(e) && e.Op() != opt.ProjectionsItemOp && e.Op() != opt.AggregationsItemOp {
+		e = e.Child(0)
+	}
+
+	if opt.IsListOp(e) {
+		f.buf.WriteByte('[')
+		for i, n := 0, e.ChildCount(); i < n; i++ {
+			if i != 0 {
+				f.buf.WriteByte(' ')
+			}
+			f.formatExpr(e.Child(i))
+		}
+		f.buf.WriteByte(']')
+		return
+	}
+
+	f.buf.WriteByte('(')
+	f.buf.WriteString(sexprOpName(e.Op()))
+	for i, n := 0, e.ChildCount(); i < n; i++ {
+		f.buf.WriteByte(' ')
+		f.formatExpr(e.Child(i))
+	}
+	f.formatPrivate(e)
+	f.buf.WriteByte(')')
+}
+
+func (f *sexprFmtCtx) formatPrivate(e opt.Expr) {
+	switch t := e.(type) {
+	case *VariableExpr:
+		f.buf.WriteByte(' ')
+		f.formatCol(t.Col)
+
+	case *ConstExpr:
+		f.buf.WriteByte(' ')
+		f.buf.WriteString(t.Value.String())
+
+	case *CastExpr:
+		f.buf.WriteByte(' ')
+		f.buf.WriteString(t.Typ.SQLString())
+
+	case *FunctionExpr:
+		f.buf.WriteByte(' ')
+		f.buf.WriteString(t.Name)
+
+	case *ScanExpr:
+		f.buf.WriteByte(' ')
+		f.buf.WriteString(string(f.md.TableMeta(t.Table).Alias.ObjectName))
+
+	case *ProjectionsItem:
+		f.buf.WriteByte(' ')
+		f.formatColWithID(t.Col)
+
+	case *AggregationsItem:
+		f.buf.WriteByte(' ')
+		f.formatColWithID(t.Col)
+
+	case *ProjectExpr:
+		f.formatColSet("Passthrough", t.Passthrough)
+	}
+
+	if private, ok := e.Private().(*GroupingPrivate); ok {
+		f.formatColSet("GroupingCols", private.GroupingCols)
+	}
+}
+
+// formatColSet writes the given set of columns as a labeled list, e.g.
+// (GroupingCols a.x:1 a.y:2). Nothing is written if the set is empty.
+func (f *sexprFmtCtx) formatColSet(label string, cols opt.ColSet) {
+	if cols.Empty() {
+		return
+	}
+	f.buf.WriteString(" (")
+	f.buf.WriteString(label)
+	cols.ForEach(func(col opt.ColumnID) {
+		f.buf.WriteByte(' ')
+		f.formatColWithID(col)
+	})
+	f.buf.WriteByte(')')
+}
+
+// formatColWithID writes the name of the given column, followed by its id.
+func (f *sexprFmtCtx) formatColWithID(col opt.ColumnID) {
+	f.formatCol(col)
+	fmt.Fprintf(&f.buf, ":%d", col)
+}
+
+// formatCol writes the name of the given column, qualified by the alias of its
+// table if it has one.
+func (f *sexprFmtCtx) formatCol(col opt.ColumnID) {
+	cm := f.md.ColumnMeta(col)
+	if cm.Table != 0 {
+		f.buf.WriteString(string(f.md.TableMeta(cm.Table).Alias.ObjectName))
+		f.buf.WriteByte('.')
+	}
+	f.buf.WriteString(cm.Alias)
+}
+
+// sexprOpName converts the dash case name of the given operator back into the
+// camel case name used by optgen, e.g. "inner-join" becomes "InnerJoin".
+func sexprOpName(op opt.Operator) string {
+	var sb strings.Builder
+	for _, part := range strings.Split(op.String(), "-") {
+		if part == "" {
+			continue
+		}
+		sb.WriteString(strings.ToUpper(part[:1]))
+		sb.WriteString(part[1:])
+	}
+	return sb.String()
+}
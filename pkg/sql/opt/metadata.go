@@ -264,6 +264,42 @@ func (md *Metadata) AddDependency(name MDDepName, ds cat.DataSource, priv privil
 	})
 }
 
+// AddDependenciesFrom adds the data source dependencies, views and user
+// defined types of the given metadata to this metadata. It is used when
+// expressions are copied from another memo, so that this memo becomes stale
+// whenever the other memo would.
+func (md *Metadata) AddDependenciesFrom(from *Metadata) {
+	for i := range from.deps {
+		dep := &from.deps[i]
+		found := false
+		for j := range md.deps {
+			if md.deps[j].ds == dep.ds && md.deps[j].name.equals(&dep.name) {
+				md.deps[j].privileges |= dep.privileges
+				found = true
+				break
+			}
+		}
+		if !found {
+			md.deps = append(md.deps, *dep)
+		}
+	}
+	for _, v := range from.views {
+		found := false
+		for _, existing := range md.views {
+			if existing == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			md.views = append(md.views, v)
+		}
+	}
+	for _, typ := range from.userDefinedTypesSlice {
+		md.AddUserDefinedType(typ)
+	}
+}
+
 // CheckDependencies resolves (again) each data source on which this metadata
 // depends, in order to check that all data source names resolve to the same
 // objects, and that the user still has sufficient privileges to access the
@@ -374,6 +410,7 @@ func (md *Metadata) AddTable(tab cat.Table, alias *tree.TableName) TableID {
 		md.tables = make([]TableMeta, 0, 4)
 	}
 	md.tables = append(md.tables, TableMeta{MetaID: tabID, Table: tab, Alias: *alias})
+	md.tables[len(md.tables)-1].cacheIndexColumns()
 
 	colCount := tab.ColumnCount()
 	if md.cols == nil {
@@ -469,6 +506,7 @@ func (md *Metadata) DuplicateTable(
 		ComputedCols:           computedCols,
 		partialIndexPredicates: partialIndexPredicates,
 	})
+	md.tables[len(md.tables)-1].cacheIndexColumns()
 
 	return newTabID
 }
@@ -13,6 +13,7 @@ package opt_test
 import (
 	"context"
 	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/cockroachdb/cockroach/pkg/sql/opt"
@@ -278,6 +279,79 @@ func TestIndexColumns(t *testing.T) {
 	}
 }
 
+// TestIndexColumnsShared tests that the sets returned by IndexColumns are not
+// modified by non-mutating set operations, and that they can be read
+// concurrently from copies of the metadata. Column IDs above 64 are used so
+// that the sets are not stored inline.
+func TestIndexColumnsShared(t *testing.T) {
+	cat := testcat.New()
+	_, err := cat.ExecuteDDL("CREATE TABLE a (k INT PRIMARY KEY, i INT, s STRING, INDEX (i, s))")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var md opt.Metadata
+	for j := 0; j < 100; j++ {
+		md.AddColumn(fmt.Sprintf("c%d", j), types.Int)
+	}
+	tn := tree.NewUnqualifiedTableName("a")
+	a := md.AddTable(cat.Table(tn), tn)
+	k, i, s := a.ColumnID(0), a.ColumnID(1), a.ColumnID(2)
+	expected := opt.MakeColSet(k, i, s)
+
+	cols := md.TableMeta(a).IndexColumns(1)
+	if !cols.Equals(expected) {
+		t.Fatalf("expected %v, got %v", expected, cols)
+	}
+	if res := cols.Intersection(opt.MakeColSet(k)); !res.Equals(opt.MakeColSet(k)) {
+		t.Fatalf("expected %v, got %v", opt.MakeColSet(k), res)
+	}
+	cp := cols.Copy()
+	cp.Remove(s)
+	if actual := md.TableMeta(a).IndexColumns(1); !actual.Equals(expected) {
+		t.Fatalf("shared set was modified: expected %v, got %v", expected, actual)
+	}
+
+	var wg sync.WaitGroup
+	for j := 0; j < 4; j++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var copied opt.Metadata
+			copied.CopyFrom(&md)
+			if actual := copied.TableMeta(a).IndexColumns(1).Intersection(opt.MakeColSet(i, s)); !actual.Equals(opt.MakeColSet(i, s)) {
+				t.Errorf("expected %v, got %v", opt.MakeColSet(i, s), actual)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkIndexColumns(b *testing.B) {
+	cat := testcat.New()
+	_, err := cat.ExecuteDDL(
+		"CREATE TABLE a (k INT PRIMARY KEY, i INT, s STRING, f FLOAT, INDEX (i, k), INDEX (s DESC) STORING(f))",
+	)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var md opt.Metadata
+	for j := 0; j < 100; j++ {
+		md.AddColumn(fmt.Sprintf("c%d", j), types.Int)
+	}
+	tn := tree.NewUnqualifiedTableName("a")
+	a := md.AddTable(cat.Table(tn), tn)
+	tabMeta := md.TableMeta(a)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for ord := 0; ord < 3; ord++ {
+			_ = tabMeta.IndexColumns(ord)
+		}
+	}
+}
+
 // TestDuplicateTable tests that we can extract a set of columns from an index ordinal.
 func TestDuplicateTable(t *testing.T) {
 	cat := testcat.New()
@@ -13,6 +13,7 @@ package norm
 import (
 	"github.com/cockroachdb/cockroach/pkg/sql/opt"
 	"github.com/cockroachdb/cockroach/pkg/sql/opt/memo"
+	"github.com/cockroachdb/cockroach/pkg/util"
 )
 
 // ConcatLeftDeepAnds concatenates any left-deep And expressions in the right
@@ -26,6 +27,14 @@ func (c *CustomFuncs) ConcatLeftDeepAnds(left, right opt.ScalarExpr) opt.ScalarE
 	return c.f.ConstructAnd(left, right)
 }
 
+// CanNegateComparison returns true if the given comparison operator has a
+// negated counterpart, like Eq and Ne. Operators like Contains and BBoxCovers
+// cannot be negated.
+func (c *CustomFuncs) CanNegateComparison(cmp opt.Operator) bool {
+	_, ok := opt.NegateOpMap[cmp]
+	return ok
+}
+
 // NegateComparison negates a comparison op like:
 //   a.x = 5
 // to:
@@ -132,3 +141,122 @@ func (c *CustomFuncs) extractConjunct(conjunct opt.ScalarExpr, and *memo.AndExpr
 	}
 	return c.f.ConstructAnd(c.extractConjunct(conjunct, and.Left.(*memo.AndExpr)), and.Right)
 }
+
+// CollapseOrToIn returns an expression that is equivalent to "left OR right",
+// in which the disjuncts that compare the same variable with constant values
+// are collapsed into a single In expression. For example:
+//
+//   x = 1 OR y = 5 OR x = 2 OR x = 3  =>  x IN (1, 2, 3) OR y = 5
+//
+// See collapseOrToIn for the conditions under which disjuncts are collapsed.
+// If no disjuncts can be collapsed, CollapseOrToIn returns ok=false.
+func (c *CustomFuncs) CollapseOrToIn(
+	left, right opt.ScalarExpr,
+) (_ opt.ScalarExpr, ok bool) {
+	disjuncts := collectDisjuncts(left, nil /* disjuncts */)
+	disjuncts = collectDisjuncts(right, disjuncts)
+	return c.collapseOrToIn(disjuncts)
+}
+
+// collectDisjuncts appends the disjuncts of the given expression to the given
+// list, in order, and returns the resulting list. Nested Or expressions are
+// flattened, regardless of their shape.
+func collectDisjuncts(e opt.ScalarExpr, disjuncts []opt.ScalarExpr) []opt.ScalarExpr {
+	if or, ok := e.(*memo.OrExpr); ok {
+		disjuncts = collectDisjuncts(or.Left, disjuncts)
+		return collectDisjuncts(or.Right, disjuncts)
+	}
+	return append(disjuncts, e)
+}
+
+// collapseOrToIn searches the given disjuncts for a variable that is compared
+// with constant values by more than one of them, either as "x = c" or as
+// "x IN (c1, c2, ...)". The constants must have the same type as the variable.
+// The matching disjuncts are collapsed into a single In expression when:
+//
+//   1. There are at least three of them. Collapsing only two equalities into
+//      an In expression does not make the expression meaningfully smaller.
+//   2. One of them is already an In expression. Adding a value to an existing
+//      In expression is always worthwhile, and it allows a chain of equalities
+//      that is built up one Or at a time to collapse into a single In.
+//
+// The In expression takes the place of the first matching disjunct, and the
+// remaining disjuncts are preserved in their original order. The constants are
+// sorted and deduplicated, so "x = 1 OR x = 2 OR x = 1" collapses to
+// "x IN (1, 2)".
+func (c *CustomFuncs) collapseOrToIn(disjuncts []opt.ScalarExpr) (_ opt.ScalarExpr, ok bool) {
+	for i := range disjuncts {
+		variable, _, _ := inListValues(disjuncts[i])
+		if variable == nil {
+			continue
+		}
+
+		var matched util.FastIntSet
+		var values memo.ScalarListExpr
+		hasIn := false
+		for j := i; j < len(disjuncts); j++ {
+			v, vals, isIn := inListValues(disjuncts[j])
+			if v != variable {
+				continue
+			}
+			matched.Add(j)
+			values = append(values, vals...)
+			hasIn = hasIn || isIn
+		}
+		if matched.Len() < 3 && !(matched.Len() == 2 && hasIn) {
+			continue
+		}
+
+		elems, typ := c.ConstructSortedUniqueList(values)
+		in := c.f.ConstructIn(variable, c.f.ConstructTuple(elems, typ))
+
+		var result opt.ScalarExpr
+		for j := range disjuncts {
+			disjunct := disjuncts[j]
+			if j == i {
+				disjunct = in
+			} else if matched.Contains(j) {
+				continue
+			}
+			if result == nil {
+				result = disjunct
+			} else {
+				result = c.f.ConstructOr(result, disjunct)
+			}
+		}
+		return result, true
+	}
+	return nil, false
+}
+
+// inListValues returns the variable and the constant values that it is
+// compared with if the given expression has the form "x = c" or
+// "x IN (c1, c2, ...)", where the constants are non-null and have the same
+// type as x. isIn is true if the expression is an In expression. If the
+// expression does not have this form, inListValues returns a nil variable.
+func inListValues(
+	e opt.ScalarExpr,
+) (variable *memo.VariableExpr, values memo.ScalarListExpr, isIn bool) {
+	switch t := e.(type) {
+	case *memo.EqExpr:
+		variable, _ = t.Left.(*memo.VariableExpr)
+		values = memo.ScalarListExpr{t.Right}
+
+	case *memo.InExpr:
+		variable, _ = t.Left.(*memo.VariableExpr)
+		tuple, ok := t.Right.(*memo.TupleExpr)
+		if !ok {
+			return nil, nil, false
+		}
+		values, isIn = tuple.Elems, true
+	}
+	if variable == nil || len(values) == 0 {
+		return nil, nil, false
+	}
+	for _, val := range values {
+		if val.Op() != opt.ConstOp || !val.DataType().Identical(variable.DataType()) {
+			return nil, nil, false
+		}
+	}
+	return variable, values, isIn
+}
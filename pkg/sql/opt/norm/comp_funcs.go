@@ -25,6 +25,11 @@ import (
 //   5 < x
 // to:
 //   x > 5
+// This is also valid when the operands are tuples, since tuple comparisons are
+// lexicographic and commute in the same way:
+//   (1, 2) < (x, y)
+// to:
+//   (x, y) > (1, 2)
 func (c *CustomFuncs) CommuteInequality(
 	op opt.Operator, left, right opt.ScalarExpr,
 ) opt.ScalarExpr {
@@ -41,6 +46,37 @@ func (c *CustomFuncs) CommuteInequality(
 	panic(errors.AssertionFailedf("called commuteInequality with operator %s", log.Safe(op)))
 }
 
+// CanNormalizeArithmeticComparison returns true if the given binary operator
+// is defined for the types of the given constant operands, and if evaluating
+// it does not result in an error. The NormalizeCmp rules use it to check that
+// a constant can be moved to the other side of a comparison. This is not safe
+// when the new constant expression cannot be evaluated, as in the case of an
+// integer overflow. For example:
+//
+//   i + -1 > 9223372036854775807
+//
+// is false for every value of i other than the minimum integer, but if it were
+// rewritten to:
+//
+//   i > 9223372036854775807 - -1
+//
+// then every evaluation of the filter would result in an overflow error.
+func (c *CustomFuncs) CanNormalizeArithmeticComparison(
+	op opt.Operator, left, right opt.ScalarExpr,
+) bool {
+	o, ok := memo.FindBinaryOverload(op, left.DataType(), right.DataType())
+	if !ok {
+		return false
+	}
+	lDatum, rDatum := memo.ExtractConstDatum(left), memo.ExtractConstDatum(right)
+	if !o.NullableArgs && (lDatum == tree.DNull || rDatum == tree.DNull) {
+		// The expression will evaluate to NULL without error.
+		return true
+	}
+	_, err := o.Fn(c.f.evalCtx, lDatum, rDatum)
+	return err == nil
+}
+
 // NormalizeTupleEquality remaps the elements of two tuples compared for
 // equality, like this:
 //   (a, b, c) = (x, y, z)
@@ -67,6 +103,28 @@ func (c *CustomFuncs) NormalizeTupleEquality(left, right memo.ScalarListExpr) op
 	return result
 }
 
+// SimplifyBoolComparison simplifies a comparison of the given boolean
+// expression with True or False, using the given Eq or Ne operator. The result
+// is either the expression itself or its negation. See the
+// SimplifyBoolComparison rule for more details.
+func (c *CustomFuncs) SimplifyBoolComparison(
+	op opt.Operator, left, right opt.ScalarExpr,
+) opt.ScalarExpr {
+	var negate bool
+	switch op {
+	case opt.EqOp:
+		negate = isFalse(right)
+	case opt.NeOp:
+		negate = isTrue(right)
+	default:
+		panic(errors.AssertionFailedf("unexpected operator: %v", log.Safe(op)))
+	}
+	if negate {
+		return c.f.ConstructNot(left)
+	}
+	return left
+}
+
 // FirstScalarListExpr returns the first ScalarExpr in the given list.
 func (c *CustomFuncs) FirstScalarListExpr(list memo.ScalarListExpr) opt.ScalarExpr {
 	return list[0]
@@ -77,6 +135,11 @@ func (c *CustomFuncs) SecondScalarListExpr(list memo.ScalarListExpr) opt.ScalarE
 	return list[1]
 }
 
+// HasTwoScalars returns true if the given list has exactly two elements.
+func (c *CustomFuncs) HasTwoScalars(list memo.ScalarListExpr) bool {
+	return len(list) == 2
+}
+
 // MakeTimeZoneFunction constructs a new timezone() function with the given zone
 // and timestamp as arguments. The type of the function result is TIMESTAMPTZ if
 // ts is of type TIMESTAMP, or TIMESTAMP if is of type TIMESTAMPTZ.
@@ -242,7 +305,7 @@ func (c *CustomFuncs) makeSTDWithin(
 	copy(newArgs, args[:distanceIdx])
 
 	// The distance parameter must be type float.
-	newArgs[distanceIdx] = c.f.ConstructCast(bound, types.Float)
+	newArgs[distanceIdx] = c.f.ConstructCast(bound, c.FloatType())
 
 	// Add the use_spheroid parameter if it exists.
 	if len(newArgs) > useSpheroidIdx {
@@ -137,7 +137,7 @@ func (c *CustomFuncs) HoistSelectSubquery(
 		item := &filters[i]
 		if item.ScalarProps().Rule.HasHoistableSubquery {
 			replaced := hoister.hoistAll(item.Condition)
-			if replaced.Op() != opt.TrueOp {
+			if !isTrue(replaced) {
 				newFilters = append(newFilters, c.f.ConstructFiltersItem(replaced))
 			}
 		} else {
@@ -211,7 +211,7 @@ func (c *CustomFuncs) HoistJoinSubquery(
 		item := &on[i]
 		if item.ScalarProps().Rule.HasHoistableSubquery {
 			replaced := hoister.hoistAll(item.Condition)
-			if replaced.Op() != opt.TrueOp {
+			if !isTrue(replaced) {
 				newFilters = append(newFilters, c.f.ConstructFiltersItem(replaced))
 			}
 		} else {
@@ -11,12 +11,18 @@
 package norm
 
 import (
+	"io"
+	"math/rand"
+
 	"github.com/cockroachdb/cockroach/pkg/sql/opt"
 	"github.com/cockroachdb/cockroach/pkg/sql/opt/cat"
 	"github.com/cockroachdb/cockroach/pkg/sql/opt/memo"
 	"github.com/cockroachdb/cockroach/pkg/sql/opt/props/physical"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgcode"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
 	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
 	"github.com/cockroachdb/cockroach/pkg/sql/types"
+	"github.com/cockroachdb/cockroach/pkg/util"
 	"github.com/cockroachdb/cockroach/pkg/util/errorutil"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/errors"
@@ -71,21 +77,58 @@ type Factory struct {
 	funcs CustomFuncs
 
 	// matchedRule is the callback function that is invoked each time a normalize
-	// rule has been matched by the factory. It can be set via a call to the
-	// NotifyOnMatchedRule method.
+	// rule has been matched by the factory. It is either userMatchedRule, or
+	// onMatchedRule if a tracer or metrics are installed; see
+	// updateRuleCallbacks.
 	matchedRule MatchedRuleFunc
 
 	// appliedRule is the callback function which is invoked each time a normalize
-	// rule has been applied by the factory. It can be set via a call to the
-	// NotifyOnAppliedRule method.
+	// rule has been applied by the factory. It is either userAppliedRule, or
+	// onAppliedRule if a tracer or metrics are installed; see
+	// updateRuleCallbacks.
 	appliedRule AppliedRuleFunc
 
+	// userMatchedRule is the callback function set via a call to the
+	// NotifyOnMatchedRule method.
+	userMatchedRule MatchedRuleFunc
+
+	// userAppliedRule is the callback function set via a call to the
+	// NotifyOnAppliedRule method.
+	userAppliedRule AppliedRuleFunc
+
 	// catalog is the opt catalog, used to resolve names during constant folding
 	// of special metadata queries like 'table_name'::regclass.
 	catalog cat.Catalog
 
 	// See FoldingControl.
 	foldingControl FoldingControl
+
+	// hoistCommonFilterExprs enables the HoistCommonFilterExprs rule. It is
+	// disabled by default; see EnableCommonFilterExprHoisting.
+	hoistCommonFilterExprs bool
+
+	// hoistCommonProjectionExprs enables the HoistCommonProjectionExprs rule. It
+	// is disabled by default; see EnableCommonProjectionExprHoisting.
+	hoistCommonProjectionExprs bool
+
+	// tracer, if non-nil, writes a trace of the applied rules. It is installed
+	// via a call to the SetTracer method.
+	tracer *Tracer
+
+	// metrics, if non-nil, counts the rules matched and applied by the factory.
+	// It is installed via a call to the SetMetrics method.
+	metrics *Metrics
+
+	// ruleShuffle, if non-nil, is used to randomly decline matched rules in
+	// order to perturb the order in which rules are applied. It is installed via
+	// a call to the SetRuleShuffleSeed method.
+	ruleShuffle *rand.Rand
+
+	// copier remaps the tables and columns of the memo from which CopyInto last
+	// copied an expression to those of this factory's memo. It is reused by
+	// subsequent calls that copy from the same memo, so that expressions copied
+	// by those calls refer to the same columns.
+	copier *memoCopier
 }
 
 // Init initializes a Factory structure with a new, blank memo structure inside.
@@ -107,10 +150,12 @@ func (f *Factory) Init(evalCtx *tree.EvalContext, catalog cat.Catalog) {
 		mem:     mem,
 		evalCtx: evalCtx,
 		catalog: catalog,
+		metrics: f.metrics,
 	}
 
 	f.funcs.Init(f)
 	f.foldingControl.DisallowStableFolds()
+	f.updateRuleCallbacks()
 }
 
 // FoldingControl returns the FoldingControl instance for this factory.
@@ -118,6 +163,25 @@ func (f *Factory) FoldingControl() *FoldingControl {
 	return &f.foldingControl
 }
 
+// EnableCommonFilterExprHoisting enables the HoistCommonFilterExprs rule, which
+// projects a non-trivial subexpression that is repeated in the filters of a
+// Select once, rather than evaluating it once per reference. The rule is
+// disabled by default so that its impact on plans can be measured before it is
+// turned on. Init resets the factory to the default.
+func (f *Factory) EnableCommonFilterExprHoisting() {
+	f.hoistCommonFilterExprs = true
+}
+
+// EnableCommonProjectionExprHoisting enables the HoistCommonProjectionExprs
+// rule, which projects a non-trivial subexpression that is repeated in the
+// projections of a Project once, in a new Project below it. Like
+// HoistCommonFilterExprs, the rule is disabled by default because extracting a
+// common subexpression is not always a win. Init resets the factory to the
+// default.
+func (f *Factory) EnableCommonProjectionExprHoisting() {
+	f.hoistCommonProjectionExprs = true
+}
+
 // DetachMemo extracts the memo from the optimizer, and then re-initializes the
 // factory so that its reuse will not impact the detached memo. This method is
 // used to extract a read-only memo during the PREPARE phase.
@@ -149,14 +213,98 @@ func (f *Factory) DisableOptimizations() {
 // addition, callers can invoke the DisableOptimizations convenience method to
 // disable all rules.
 func (f *Factory) NotifyOnMatchedRule(matchedRule MatchedRuleFunc) {
-	f.matchedRule = matchedRule
+	f.userMatchedRule = matchedRule
+	f.updateRuleCallbacks()
 }
 
 // NotifyOnAppliedRule sets a callback function which is invoked each time a
 // normalize rule has been applied by the factory. If appliedRule is nil, then
 // no further notifications are sent.
 func (f *Factory) NotifyOnAppliedRule(appliedRule AppliedRuleFunc) {
-	f.appliedRule = appliedRule
+	f.userAppliedRule = appliedRule
+	f.updateRuleCallbacks()
+}
+
+// SetTracer installs a Tracer that writes each normalization rule applied by
+// the factory to w, with the given level of detail. Callbacks installed with
+// NotifyOnMatchedRule and NotifyOnAppliedRule continue to be invoked after the
+// Tracer has written its output. If w is nil, the Tracer is removed. Init
+// removes the Tracer.
+func (f *Factory) SetTracer(w io.Writer, verbosity TraceVerbosity) {
+	f.tracer = nil
+	if w != nil {
+		f.tracer = &Tracer{f: f, w: w, verbosity: verbosity}
+	}
+	f.updateRuleCallbacks()
+}
+
+// SetMetrics attaches a Metrics object that counts the normalization rules
+// matched and applied by the factory. The same Metrics object can be shared by
+// any number of factories. Unlike other factory options, the Metrics object is
+// retained by Init, so that a factory which is reused across queries continues
+// to report to it. If m is nil, the factory stops reporting metrics.
+func (f *Factory) SetMetrics(m *Metrics) {
+	f.metrics = m
+	f.updateRuleCallbacks()
+}
+
+// SetRuleShuffleSeed perturbs the order in which normalization rules are
+// applied, in order to test that normalization is confluent. The generated
+// factory code always tries the rules that match an expression in priority
+// order, so the order is perturbed by randomly declining matched rules, using a
+// pseudo-random generator with the given seed. This gives lower priority rules
+// the chance to apply first. Essential rules (see opt.RuleName.IsEssential) are
+// never declined. Declined rules are not retried, so the result may not be
+// fully normalized; see CheckRuleShuffle, which renormalizes it. This is only
+// intended for tests. Init removes the shuffle.
+func (f *Factory) SetRuleShuffleSeed(seed int64) {
+	f.ruleShuffle = rand.New(rand.NewSource(seed))
+	f.updateRuleCallbacks()
+}
+
+// updateRuleCallbacks sets the matchedRule and appliedRule callbacks invoked
+// by the normalization rules. If no tracer, metrics or rule shuffle are
+// installed, the user callbacks are invoked directly, so that the common case
+// incurs no additional overhead.
+func (f *Factory) updateRuleCallbacks() {
+	if f.tracer == nil && f.metrics == nil && f.ruleShuffle == nil {
+		f.matchedRule = f.userMatchedRule
+		f.appliedRule = f.userAppliedRule
+		return
+	}
+	f.matchedRule = f.onMatchedRule
+	f.appliedRule = f.onAppliedRule
+}
+
+// onMatchedRule records a matched rule in the metrics and tracer, and defers
+// to the user callback and the rule shuffle to decide whether the rule is
+// applied.
+func (f *Factory) onMatchedRule(ruleName opt.RuleName) bool {
+	if f.metrics != nil {
+		f.metrics.recordMatched(ruleName)
+	}
+	if (f.userMatchedRule != nil && !f.userMatchedRule(ruleName)) ||
+		(f.ruleShuffle != nil && !ruleName.IsEssential() && f.ruleShuffle.Intn(2) == 0) {
+		if f.tracer != nil {
+			f.tracer.skippedRule(ruleName)
+		}
+		return false
+	}
+	return true
+}
+
+// onAppliedRule records an applied rule in the metrics and tracer, and then
+// invokes the user callback.
+func (f *Factory) onAppliedRule(ruleName opt.RuleName, source, target opt.Expr) {
+	if f.metrics != nil {
+		f.metrics.recordApplied(ruleName)
+	}
+	if f.tracer != nil {
+		f.tracer.appliedRule(ruleName, source, target)
+	}
+	if f.userAppliedRule != nil {
+		f.userAppliedRule(ruleName, source, target)
+	}
 }
 
 // Memo returns the memo structure that the factory is operating upon.
@@ -170,6 +318,31 @@ func (f *Factory) Metadata() *opt.Metadata {
 	return f.mem.Metadata()
 }
 
+// MemoStats returns statistics about the size of the factory's memo. See
+// memo.Memo.Stats.
+func (f *Factory) MemoStats() memo.MemoStats {
+	return f.mem.Stats()
+}
+
+// FormatExpr returns a multi-line tree representation of the given expression,
+// which must be part of the factory's memo, formatted according to the given
+// flags. It can be called at any point during normalization, including from
+// the rule callbacks. Formatting only reads properties that were derived when
+// the expression was constructed, so it never constructs or interns new
+// expressions, and it leaves the memo unchanged.
+func (f *Factory) FormatExpr(e opt.Expr, flags memo.ExprFmtFlags) string {
+	return memo.FormatExpr(e, flags, f.mem, f.catalog)
+}
+
+// FormatExprOneLine returns a compact, single-line representation of the given
+// expression, in the s-expression syntax used by the normalization rules (see
+// memo.FormatSExpr). No properties are shown, so column lists and other
+// logical properties are elided. Like FormatExpr, it leaves the memo
+// unchanged.
+func (f *Factory) FormatExprOneLine(e opt.Expr) string {
+	return memo.FormatSExpr(e, f.Metadata())
+}
+
 // CustomFuncs returns the set of custom functions used by normalization rules.
 func (f *Factory) CustomFuncs() *CustomFuncs {
 	return &f.funcs
@@ -225,11 +398,122 @@ func (f *Factory) CopyAndReplace(
 	f.Memo().SetRoot(to, fromProps)
 }
 
+// CopyInto copies the given normalized expression subtree, which can be either
+// relational or scalar and which belongs to the "from" memo, into this
+// factory's memo, and returns the copy. Unlike CopyAndReplace, the copy does not
+// become the root of the destination memo, so CopyInto can be called multiple
+// times to copy several subtrees into the same memo. Lists and privates are
+// re-interned in the destination memo as the copy proceeds, and rules are
+// applied to the copied expressions as usual.
+//
+// The destination memo does not need to be empty. Each table and column of the
+// "from" memo that the subtree references is added to the destination metadata
+// with a new id, and references to it are remapped. Consecutive calls that copy
+// from the same memo share the mapping, so that the copies refer to the same
+// columns in the destination memo. The dependencies of the "from" memo are
+// added to the destination memo, so that it becomes stale whenever the "from"
+// memo would.
+func (f *Factory) CopyInto(from *memo.Memo, src opt.Expr) opt.Expr {
+	if f.copier == nil || f.copier.from != from {
+		f.copier = &memoCopier{f: f, from: from}
+		f.mem.Metadata().AddDependenciesFrom(from.Metadata())
+	}
+	return f.copier.copyExpr(src)
+}
+
+// ReplaceSubtree returns an expression tree that is identical to root, except
+// that every occurrence of the target expression is replaced by replacement.
+// Since expressions are interned, target is compared to each expression in
+// root by identity; a relational target matches any member of its memo group.
+// The operators on the path from root to each occurrence are reconstructed
+// with their new children, which applies normalization rules to them as usual.
+// Operators whose children do not contain the target are not reconstructed.
+//
+// Lists and list items are not interned, so target cannot be a list or list
+// item. It is the caller's responsibility to ensure that replacement is valid
+// in place of target; for example, that it has the same type or output
+// columns.
+func (f *Factory) ReplaceSubtree(root, target, replacement opt.Expr) opt.Expr {
+	if opt.IsListOp(target) || opt.IsListItemOp(target) {
+		panic(errors.AssertionFailedf("cannot replace list expression %s", log.Safe(target.Op())))
+	}
+	if rel, ok := target.(memo.RelExpr); ok {
+		target = rel.FirstExpr()
+	}
+
+	var replace ReplaceFunc
+	replace = func(e opt.Expr) opt.Expr {
+		first := e
+		if rel, ok := e.(memo.RelExpr); ok {
+			first = rel.FirstExpr()
+		}
+		if first == target {
+			return replacement
+		}
+		return f.Replace(e, replace)
+	}
+	return replace(root)
+}
+
+// AssertNormalized checks that the given expression tree, which must belong to
+// this factory's memo, is at a fixed point of the normalization rules: that is,
+// that no rule would match if any expression in the tree were constructed again
+// from its existing children. If a rule would match, AssertNormalized returns
+// its name and ok=false. Expressions are checked bottom-up, so the rule that is
+// returned belongs to the innermost expression that is not normalized.
+//
+// The check reconstructs each expression in a dry-run mode, in which every
+// matched rule is declined (and not reported to callbacks, metrics or the
+// tracer). The reconstructed expressions are therefore identical to the
+// originals and are interned to them, though rules that construct expressions
+// while matching may still add those to the memo. Since every expression in
+// the tree is reconstructed, AssertNormalized is only intended for tests and
+// debugging.
+func (f *Factory) AssertNormalized(e opt.Expr) (_ opt.RuleName, ok bool) {
+	ruleName := opt.InvalidRuleName
+	f.matchedRule = func(matched opt.RuleName) bool {
+		if ruleName == opt.InvalidRuleName {
+			ruleName = matched
+		}
+		return false
+	}
+	f.appliedRule = nil
+	defer f.updateRuleCallbacks()
+
+	keepChildren := func(e opt.Expr) opt.Expr { return e }
+	var check func(e opt.Expr) bool
+	check = func(e opt.Expr) bool {
+		if rel, ok := e.(memo.RelExpr); ok {
+			e = rel.FirstExpr()
+		}
+		for i, n := 0, e.ChildCount(); i < n; i++ {
+			if !check(e.Child(i)) {
+				return false
+			}
+		}
+		// Lists and list items are constructed without applying rules; they are
+		// checked when their parent is reconstructed. Enforcers are not created by
+		// the factory.
+		if opt.IsListOp(e) || opt.IsListItemOp(e) || opt.IsEnforcerOp(e) {
+			return true
+		}
+		f.CopyAndReplaceDefault(e, keepChildren)
+		return ruleName == opt.InvalidRuleName
+	}
+	if check(e) {
+		return opt.InvalidRuleName, true
+	}
+	return ruleName, false
+}
+
 // AssignPlaceholders is used just before execution of a prepared Memo. It makes
 // a copy of the given memo, but with any placeholder values replaced by their
 // assigned values. This can trigger additional normalization rules that can
 // substantially rewrite the tree. Once all placeholders are assigned, the
 // exploration phase can begin.
+//
+// An error is returned if a placeholder has no assigned value, or if its value
+// does not have the type that the placeholder had when the memo was prepared.
 func (f *Factory) AssignPlaceholders(from *memo.Memo) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -250,10 +534,23 @@ func (f *Factory) AssignPlaceholders(from *memo.Memo) (err error) {
 	var replaceFn ReplaceFunc
 	replaceFn = func(e opt.Expr) opt.Expr {
 		if placeholder, ok := e.(*memo.PlaceholderExpr); ok {
-			d, err := e.(*memo.PlaceholderExpr).Value.Eval(f.evalCtx)
+			if !f.evalCtx.HasPlaceholders() {
+				// Placeholders evaluate to themselves when no values are available,
+				// so this case must be detected up front.
+				panic(pgerror.Newf(pgcode.UndefinedParameter,
+					"no value provided for placeholder: %s", placeholder.Value,
+				))
+			}
+			d, err := placeholder.Value.Eval(f.evalCtx)
 			if err != nil {
 				panic(err)
 			}
+			if d != tree.DNull && !d.ResolvedType().Equivalent(placeholder.DataType()) {
+				panic(pgerror.Newf(pgcode.DatatypeMismatch,
+					"value for placeholder %s has type %s, expected %s",
+					placeholder.Value, d.ResolvedType(), placeholder.DataType(),
+				))
+			}
 			return f.ConstructConstVal(d, placeholder.DataType())
 		}
 		return f.CopyAndReplaceDefault(e, replaceFn)
@@ -278,7 +575,7 @@ func (f *Factory) onConstructRelational(rel memo.RelExpr) memo.RelExpr {
 		// empty input has to error out if the limit turns out to be negative.
 		if relational.Cardinality.IsZero() && relational.VolatilitySet.IsLeakProof() {
 			if f.matchedRule == nil || f.matchedRule(opt.SimplifyZeroCardinalityGroup) {
-				values := f.funcs.ConstructEmptyValues(relational.OutputCols)
+				values := f.ConstructEmptyRelation(relational.OutputCols)
 				if f.appliedRule != nil {
 					f.appliedRule(opt.SimplifyZeroCardinalityGroup, nil, values)
 				}
@@ -306,9 +603,64 @@ func (f *Factory) onConstructScalar(scalar opt.ScalarExpr) opt.ScalarExpr {
 // ConstructZeroValues constructs a Values operator with zero rows and zero
 // columns. It is used to create a dummy input for operators like CreateTable.
 func (f *Factory) ConstructZeroValues() memo.RelExpr {
+	return f.ConstructEmptyRelation(opt.ColSet{})
+}
+
+// ConstructEmptyRelation constructs a Values operator with zero rows and the
+// given output columns. This is the canonical relation used when an expression
+// is known to produce no rows: its cardinality is [0 - 0], and since it has no
+// rows, every column is not null and constant.
+//
+// The columns are listed in increasing order, and as long as there is at least
+// one column, the Values operator is given a zero ID. Columns are unique within
+// a query, so the column set is enough to identify the relation, and rules that
+// produce an empty relation with the same columns are interned to the same
+// memo group. Without columns, a fresh ID is needed to distinguish relations
+// that appear in different places in the query.
+func (f *Factory) ConstructEmptyRelation(cols opt.ColSet) memo.RelExpr {
+	var id opt.UniqueID
+	if cols.Empty() {
+		id = f.Metadata().NextUniqueID()
+	}
 	return f.ConstructValues(memo.EmptyScalarListExpr, &memo.ValuesPrivate{
-		Cols: opt.ColList{},
-		ID:   f.Metadata().NextUniqueID(),
+		Cols: cols.ToList(),
+		ID:   id,
+	})
+}
+
+// ConstructValuesFromDatums constructs a Values operator with the given output
+// columns and one row for each of the given rows of constant datums. Each row
+// must have one datum per column, and each datum is given the type of its
+// column. If there are no rows, the result is built by ConstructEmptyRelation,
+// which lists the columns in increasing order rather than in the given order.
+func (f *Factory) ConstructValuesFromDatums(rows []tree.Datums, cols opt.ColList) memo.RelExpr {
+	if len(rows) == 0 {
+		return f.ConstructEmptyRelation(cols.ToSet())
+	}
+	md := f.Metadata()
+
+	typs := make([]*types.T, len(cols))
+	for i, col := range cols {
+		typs[i] = md.ColumnMeta(col).Type
+	}
+	tupleTyp := types.MakeTuple(typs)
+
+	scalarRows := make(memo.ScalarListExpr, len(rows))
+	for i, row := range rows {
+		if len(row) != len(cols) {
+			panic(errors.AssertionFailedf(
+				"row has %d datums but there are %d columns", len(row), len(cols),
+			))
+		}
+		elems := make(memo.ScalarListExpr, len(row))
+		for j := range row {
+			elems[j] = f.ConstructConstVal(row[j], typs[j])
+		}
+		scalarRows[i] = f.ConstructTuple(elems, tupleTyp)
+	}
+	return f.ConstructValues(scalarRows, &memo.ValuesPrivate{
+		Cols: cols,
+		ID:   md.NextUniqueID(),
 	})
 }
 
@@ -346,17 +698,40 @@ func (f *Factory) ConstructJoin(
 // given datum value. While most constants are represented with Const, there are
 // special-case operators for True, False, and Null, to make matching easier.
 // Null operators require the static type to be specified, so that rewrites do
-// not change it.
+// not change it. In crdb_test builds, the datum's type family is checked
+// against the family of the given static type.
 func (f *Factory) ConstructConstVal(d tree.Datum, t *types.T) opt.ScalarExpr {
 	if d == tree.DNull {
-		return f.ConstructNull(t)
+		return f.ConstructNullOfType(t)
+	}
+	if util.CrdbTestBuild {
+		if dt := d.ResolvedType(); t.Family() != types.AnyFamily && dt.Family() != t.Family() {
+			panic(errors.AssertionFailedf(
+				"datum of type %s does not match static type %s", dt, t,
+			))
+		}
 	}
 	if boolVal, ok := d.(*tree.DBool); ok {
 		// Map True/False datums to True/False operator.
-		if *boolVal {
-			return memo.TrueSingleton
-		}
-		return memo.FalseSingleton
+		return f.ConstructBoolVal(bool(*boolVal))
 	}
 	return f.ConstructConst(d, t)
 }
+
+// ConstructBoolVal returns the True or False operator, depending on the given
+// value.
+func (f *Factory) ConstructBoolVal(b bool) opt.ScalarExpr {
+	if b {
+		return memo.TrueSingleton
+	}
+	return memo.FalseSingleton
+}
+
+// ConstructNullOfType constructs a Null operator with the given static type.
+// Use types.Unknown rather than nil for a NULL that has no static type.
+func (f *Factory) ConstructNullOfType(t *types.T) opt.ScalarExpr {
+	if util.CrdbTestBuild && t == nil {
+		panic(errors.AssertionFailedf("Null operator requires a static type"))
+	}
+	return f.ConstructNull(t)
+}
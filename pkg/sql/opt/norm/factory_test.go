@@ -11,12 +11,16 @@
 package norm_test
 
 import (
+	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
 	"github.com/cockroachdb/cockroach/pkg/sql/opt"
 	"github.com/cockroachdb/cockroach/pkg/sql/opt/memo"
 	"github.com/cockroachdb/cockroach/pkg/sql/opt/norm"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/props"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/props/physical"
 	"github.com/cockroachdb/cockroach/pkg/sql/opt/testutils"
 	"github.com/cockroachdb/cockroach/pkg/sql/opt/testutils/testcat"
 	"github.com/cockroachdb/cockroach/pkg/sql/opt/xform"
@@ -67,6 +71,196 @@ func TestSimplifyFilters(t *testing.T) {
 	if len(sel.(*memo.SelectExpr).Filters) != 1 {
 		t.Fatalf("filters result should have filtered True operator")
 	}
+
+	// Already simplified filters are returned as is, and result in the same
+	// expression rather than a new one.
+	filters = memo.FiltersExpr{f.ConstructFiltersItem(eq)}
+	if simplified := f.CustomFuncs().SimplifyFilters(filters); &simplified[0] != &filters[0] {
+		t.Fatalf("simplified filters should have been returned as is")
+	}
+	if sel2 := f.ConstructSelect(vals, filters); sel2 != sel {
+		t.Fatalf("simplified filters should have resulted in the same expression")
+	}
+}
+
+// TestSimplifyFiltersNestedAnds tests that CustomFuncs.SimplifyFilters fully
+// flattens And operators that are nested more than one level deep, which can
+// happen when a condition is constructed while rules are disabled.
+func TestSimplifyFiltersNestedAnds(t *testing.T) {
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+
+	cat := testcat.New()
+	if _, err := cat.ExecuteDDL("CREATE TABLE a (x INT PRIMARY KEY, y INT, z INT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	var f norm.Factory
+	f.Init(&evalCtx, cat)
+
+	tn := tree.NewTableNameWithSchema("t", tree.PublicSchemaName, "a")
+	a := f.Metadata().AddTable(cat.Table(tn), tn)
+	eqConst := func(ord int, val int) opt.ScalarExpr {
+		return f.ConstructEq(
+			f.ConstructVariable(a.ColumnID(ord)), f.ConstructConst(tree.NewDInt(tree.DInt(val)), types.Int),
+		)
+	}
+	eqX, eqY, eqZ := eqConst(0, 1), eqConst(1, 2), eqConst(2, 3)
+
+	// Build the un-normalized conditions while rules are disabled.
+	f.DisableOptimizations()
+	and := func(left, right opt.ScalarExpr) opt.ScalarExpr {
+		return f.DynamicConstruct(opt.AndOp, left, right).(opt.ScalarExpr)
+	}
+	testCases := []struct {
+		cond     opt.ScalarExpr
+		expected []opt.ScalarExpr
+	}{
+		{
+			// x = 1 AND (y = 2 AND (z = 3 AND true))
+			cond:     and(eqX, and(eqY, and(eqZ, memo.TrueSingleton))),
+			expected: []opt.ScalarExpr{eqX, eqY, eqZ},
+		},
+		{
+			// NULL OR ((x = 1 AND y = 2) AND z = 3)
+			cond: f.DynamicConstruct(
+				opt.OrOp, memo.NullSingleton, and(and(eqX, eqY), eqZ),
+			).(opt.ScalarExpr),
+			expected: []opt.ScalarExpr{eqX, eqY, eqZ},
+		},
+		{
+			// (x = 1 AND (y = 2 AND z = 3)) IS true
+			cond: f.DynamicConstruct(
+				opt.IsOp, and(eqX, and(eqY, eqZ)), memo.TrueSingleton,
+			).(opt.ScalarExpr),
+			expected: []opt.ScalarExpr{eqX, eqY, eqZ},
+		},
+		{
+			// x = 1 AND (y = 2 AND NULL)
+			cond:     and(eqX, and(eqY, memo.NullSingleton)),
+			expected: []opt.ScalarExpr{memo.FalseSingleton},
+		},
+	}
+
+	for _, tc := range testCases {
+		filters := f.CustomFuncs().SimplifyFilters(memo.FiltersExpr{f.ConstructFiltersItem(tc.cond)})
+		actual := make([]opt.ScalarExpr, len(filters))
+		equal := len(filters) == len(tc.expected)
+		for i := range filters {
+			actual[i] = filters[i].Condition
+			equal = equal && actual[i] == tc.expected[i]
+		}
+		if !equal {
+			format := func(conds []opt.ScalarExpr) []string {
+				res := make([]string, len(conds))
+				for i := range conds {
+					res[i] = memo.FormatSExpr(conds[i], f.Metadata())
+				}
+				return res
+			}
+			t.Errorf("%s: expected %v, got %v",
+				memo.FormatSExpr(tc.cond, f.Metadata()), format(tc.expected), format(actual))
+		}
+	}
+}
+
+// TestConstructValuesFromDatums tests factory.ConstructValuesFromDatums.
+func TestConstructValuesFromDatums(t *testing.T) {
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+
+	var f norm.Factory
+	f.Init(&evalCtx, nil /* catalog */)
+	md := f.Metadata()
+	cols := opt.ColList{
+		md.AddColumn("x", types.Int),
+		md.AddColumn("y", types.String),
+	}
+
+	rows := []tree.Datums{
+		{tree.NewDInt(1), tree.NewDString("foo")},
+		{tree.NewDInt(2), tree.DNull},
+	}
+	values := f.ConstructValuesFromDatums(rows, cols)
+	if !values.Relational().OutputCols.Equals(cols.ToSet()) {
+		t.Errorf("expected output columns %s, got %s", cols.ToSet(), values.Relational().OutputCols)
+	}
+	if card := values.Relational().Cardinality; card != (props.Cardinality{Min: 2, Max: 2}) {
+		t.Errorf("expected cardinality [2 - 2], got %s", card)
+	}
+	if !values.Relational().NotNullCols.Equals(opt.MakeColSet(cols[0])) {
+		t.Errorf("expected only x to be not null, got %s", values.Relational().NotNullCols)
+	}
+	tup := values.(*memo.ValuesExpr).Rows[1].(*memo.TupleExpr)
+	if tup.Elems[1].Op() != opt.NullOp || !tup.Elems[1].DataType().Identical(types.String) {
+		t.Errorf("expected a NULL of type STRING, got %s of type %s", tup.Elems[1].Op(), tup.Elems[1].DataType())
+	}
+
+	// With no rows, the result is an empty relation.
+	empty := f.ConstructValuesFromDatums(nil /* rows */, cols)
+	if card := empty.Relational().Cardinality; !card.IsZero() {
+		t.Errorf("expected cardinality [0 - 0], got %s", card)
+	}
+	if !empty.Relational().OutputCols.Equals(cols.ToSet()) {
+		t.Errorf("expected output columns %s, got %s", cols.ToSet(), empty.Relational().OutputCols)
+	}
+}
+
+func TestReplaceSubtree(t *testing.T) {
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+
+	var f norm.Factory
+	f.Init(&evalCtx, nil /* catalog */)
+	md := f.Metadata()
+	x := f.ConstructVariable(md.AddColumn("x", types.Int))
+	y := f.ConstructVariable(md.AddColumn("y", types.Int))
+	z := f.ConstructVariable(md.AddColumn("z", types.Int))
+	one := f.ConstructConstVal(tree.NewDInt(1), types.Int)
+	five := f.ConstructConstVal(tree.NewDInt(5), types.Int)
+
+	// (x + 1) < ((x + 1) * y)
+	xPlusOne := f.ConstructPlus(x, one)
+	root := f.ConstructLt(xPlusOne, f.ConstructMult(xPlusOne, y))
+
+	// values is a single-row Values expression, used as a relational target.
+	values := f.ConstructValuesFromDatums(
+		[]tree.Datums{{tree.NewDInt(1)}}, opt.ColList{md.AddColumn("v", types.Int)},
+	)
+	exists := f.ConstructExists(values, &memo.SubqueryPrivate{})
+	empty := f.ConstructEmptyRelation(values.Relational().OutputCols)
+
+	testCases := []struct {
+		root        opt.Expr
+		target      opt.Expr
+		replacement opt.Expr
+		expected    string
+	}{
+		// Leaf target with multiple occurrences at different depths. The
+		// rebuilt operators are normalized.
+		{root, x, five, "(Gt (Mult (Variable y) (Const 6)) (Const 6))"},
+
+		// Intermediate target with multiple occurrences.
+		{root, xPlusOne, z, "(Lt (Variable z) (Mult (Variable z) (Variable y)))"},
+
+		// Target is the root.
+		{root, root, z, "(Variable z)"},
+
+		// Target does not occur.
+		{root, z, five, "(Lt (Plus (Variable x) (Const 1)) (Mult (Plus (Variable x) (Const 1)) (Variable y)))"},
+
+		// Relational target within a scalar expression.
+		{exists, values, empty, "(False)"},
+	}
+
+	for _, tc := range testCases {
+		actual := f.ReplaceSubtree(tc.root, tc.target, tc.replacement)
+		if s := memo.FormatSExpr(actual, md); s != tc.expected {
+			t.Errorf("expected %s, got %s", tc.expected, s)
+		}
+	}
+
+	// The root is not reconstructed if it does not contain the target.
+	if actual := f.ReplaceSubtree(root, z, five); actual != root {
+		t.Errorf("expected root to be returned unchanged")
+	}
 }
 
 // Test CopyAndReplace on an already optimized join. Before CopyAndReplace is
@@ -116,6 +310,71 @@ func TestCopyAndReplace(t *testing.T) {
 	}
 }
 
+// TestCopyAndReplaceScanWithValues tests that CopyAndReplace can substitute a
+// Values expression for a Scan, and that normalization rules fire on the
+// rebuilt tree as it is constructed in the destination memo.
+func TestCopyAndReplaceScanWithValues(t *testing.T) {
+	cat := testcat.New()
+	if _, err := cat.ExecuteDDL("CREATE TABLE ab (a INT PRIMARY KEY, b INT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+
+	var o xform.Optimizer
+	testutils.BuildQuery(t, &o, cat, &evalCtx, "SELECT a + 1 FROM ab WHERE b > 1")
+	m := o.Factory().DetachMemo()
+
+	var f norm.Factory
+	f.Init(&evalCtx, cat)
+	applied := make(map[opt.RuleName]bool)
+	f.NotifyOnAppliedRule(func(ruleName opt.RuleName, source, target opt.Expr) {
+		applied[ruleName] = true
+	})
+
+	// Replace the scan of ab with the single row (1, 2).
+	var replaceFn norm.ReplaceFunc
+	replaceFn = func(e opt.Expr) opt.Expr {
+		if scan, ok := e.(*memo.ScanExpr); ok {
+			row := f.ConstructTuple(
+				memo.ScalarListExpr{
+					f.ConstructConstVal(tree.NewDInt(1), types.Int),
+					f.ConstructConstVal(tree.NewDInt(2), types.Int),
+				},
+				types.MakeTuple([]*types.T{types.Int, types.Int}),
+			)
+			return f.ConstructValues(memo.ScalarListExpr{row}, &memo.ValuesPrivate{
+				Cols: scan.Cols.ToList(),
+				ID:   f.Metadata().NextUniqueID(),
+			})
+		}
+		return f.CopyAndReplaceDefault(e, replaceFn)
+	}
+	f.CopyAndReplace(m.RootExpr().(memo.RelExpr), m.RootProps(), replaceFn)
+
+	// The filter and projection are inlined and folded, leaving a single
+	// Values expression.
+	for _, rule := range []opt.RuleName{
+		opt.InlineSelectConstants, opt.EliminateSelect, opt.MergeProjectWithValues,
+	} {
+		if !applied[rule] {
+			t.Errorf("expected %s to be applied", rule)
+		}
+	}
+	values, ok := f.Memo().RootExpr().(*memo.ValuesExpr)
+	if !ok {
+		t.Fatalf("expected values, got %s", f.Memo().RootExpr().Op())
+	}
+	if len(values.Rows) != 1 {
+		t.Fatalf("expected one row, got %d", len(values.Rows))
+	}
+	elems := values.Rows[0].(*memo.TupleExpr).Elems
+	if len(elems) != 1 || elems[0].Op() != opt.ConstOp ||
+		*memo.ExtractConstDatum(elems[0]).(*tree.DInt) != 2 {
+		t.Fatalf("expected row (2), got %s", values.Rows[0])
+	}
+}
+
 // Test that CopyAndReplace works on expressions using WithScan.
 func TestCopyAndReplaceWithScan(t *testing.T) {
 	cat := testcat.New()
@@ -158,3 +417,474 @@ func TestCopyAndReplaceWithScan(t *testing.T) {
 		})
 	}
 }
+
+// TestCopyInto tests that relational and scalar subtrees of one memo can be
+// copied into another memo, which may already contain expressions, and that
+// the copies are identical to the originals, except for their column ids.
+func TestCopyInto(t *testing.T) {
+	cat := testcat.New()
+	if _, err := cat.ExecuteDDL("CREATE TABLE ab (a INT PRIMARY KEY, b INT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+	var o xform.Optimizer
+	testutils.BuildQuery(t, &o, cat, &evalCtx, "SELECT a, b + 1 FROM ab WHERE a > 1")
+	m := o.Factory().DetachMemo()
+
+	root, ok := m.RootExpr().(*memo.ProjectExpr)
+	if !ok {
+		t.Fatalf("expected project, got %s", m.RootExpr().Op())
+	}
+
+	// The copies are assigned new column ids in a non-empty destination memo,
+	// so the ids are removed before the copies are compared to the originals.
+	colIDs := regexp.MustCompile(`:\d+`)
+	format := func(e opt.Expr, m *memo.Memo) string {
+		return colIDs.ReplaceAllString(memo.FormatExpr(e, memo.ExprFmtHideAll, m, cat), "")
+	}
+
+	for _, dstQuery := range []string{"", "SELECT b FROM ab WHERE b < 10"} {
+		t.Run(dstQuery, func(t *testing.T) {
+			var dst xform.Optimizer
+			if dstQuery == "" {
+				dst.Init(&evalCtx, cat)
+			} else {
+				testutils.BuildQuery(t, &dst, cat, &evalCtx, dstQuery)
+			}
+			f := dst.Factory()
+			numCols := f.Metadata().NumColumns()
+
+			for _, src := range []opt.Expr{root, root.Input, root.Projections[0].Element} {
+				copied := f.CopyInto(m, src)
+				if expected, actual := format(src, m), format(copied, f.Memo()); expected != actual {
+					t.Errorf("expected:\n%s\nactual:\n%s", expected, actual)
+				}
+				if rel, ok := copied.(memo.RelExpr); ok {
+					if rel.Memo() != f.Memo() {
+						t.Errorf("expected copy of %s to belong to destination memo", src.Op())
+					}
+					// The copy must not refer to the columns that were already in
+					// the destination memo.
+					rel.Relational().OutputCols.ForEach(func(col opt.ColumnID) {
+						if int(col) <= numCols {
+							t.Errorf("expected copy of %s to have new columns, got %s",
+								src.Op(), rel.Relational().OutputCols)
+						}
+					})
+				}
+			}
+
+			// Subtrees copied from the same memo share their columns.
+			input := f.CopyInto(m, root.Input).(memo.RelExpr)
+			copiedRoot := f.CopyInto(m, root).(*memo.ProjectExpr)
+			if copiedRoot.Input != input {
+				t.Errorf("expected copies of the same subtree to be interned")
+			}
+		})
+	}
+}
+
+// TestNullableCols tests the NullableCols and HasNullableCols custom functions
+// over relations with varying nullability.
+func TestNullableCols(t *testing.T) {
+	cat := testcat.New()
+	if _, err := cat.ExecuteDDL("CREATE TABLE a (x INT PRIMARY KEY, y INT, z INT NOT NULL)"); err != nil {
+		t.Fatal(err)
+	}
+
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+	testCases := []struct {
+		query    string
+		expected opt.ColSet
+	}{
+		{query: "SELECT x, y, z FROM a", expected: opt.MakeColSet(2)},
+		{query: "SELECT x, z FROM a", expected: opt.ColSet{}},
+		{query: "SELECT y, z FROM a WHERE y > 0", expected: opt.ColSet{}},
+		{query: "SELECT a1.x, a2.z FROM a AS a1 LEFT JOIN a AS a2 ON a1.x = a2.x", expected: opt.MakeColSet(8)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			var o xform.Optimizer
+			testutils.BuildQuery(t, &o, cat, &evalCtx, tc.query)
+
+			root := o.Memo().RootExpr().(memo.RelExpr)
+			funcs := o.Factory().CustomFuncs()
+			if actual := funcs.NullableCols(root); !actual.Equals(tc.expected) {
+				t.Errorf("expected nullable cols %s, got %s", tc.expected, actual)
+			}
+			if actual := funcs.HasNullableCols(root); actual != !tc.expected.Empty() {
+				t.Errorf("expected HasNullableCols to return %t, got %t", !tc.expected.Empty(), actual)
+			}
+		})
+	}
+}
+
+// TestMemoStats tests that the memo statistics grow as expected as an
+// expression tree is constructed.
+func TestMemoStats(t *testing.T) {
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+
+	cat := testcat.New()
+	if _, err := cat.ExecuteDDL("CREATE TABLE a (x INT PRIMARY KEY, y INT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	var f norm.Factory
+	f.Init(&evalCtx, cat)
+	f.DisableOptimizations()
+
+	check := func(groups, relExprs, scalarExprs, physProps int) {
+		t.Helper()
+		stats := f.MemoStats()
+		if stats.Groups != groups || stats.RelExprs != relExprs ||
+			stats.ScalarExprs != scalarExprs || stats.PhysicalProps != physProps {
+			t.Fatalf("expected %d groups, %d rel exprs, %d scalar exprs, %d physical props; got %+v",
+				groups, relExprs, scalarExprs, physProps, stats)
+		}
+		if stats.MemoryEstimate != f.Memo().MemoryEstimate() {
+			t.Fatalf("expected memory estimate %d, got %d",
+				f.Memo().MemoryEstimate(), stats.MemoryEstimate)
+		}
+		if stats.HashCollisions != 0 {
+			t.Fatalf("expected no hash collisions, got %d", stats.HashCollisions)
+		}
+	}
+	check(0, 0, 0, 0)
+
+	tn := tree.NewTableNameWithSchema("t", tree.PublicSchemaName, "a")
+	a := f.Metadata().AddTable(cat.Table(tn), tn)
+	ax := a.ColumnID(0)
+	scanPrivate := &memo.ScanPrivate{Table: a, Cols: opt.MakeColSet(ax)}
+
+	scan := f.ConstructScan(scanPrivate)
+	check(1 /* groups */, 1 /* relExprs */, 0 /* scalarExprs */, 0 /* physProps */)
+
+	// Variable, Const, and Gt are each interned.
+	gt := f.ConstructGt(f.ConstructVariable(ax), f.ConstructConst(tree.NewDInt(1), types.Int))
+	check(1 /* groups */, 1 /* relExprs */, 3 /* scalarExprs */, 0 /* physProps */)
+
+	f.ConstructSelect(scan, memo.FiltersExpr{f.ConstructFiltersItem(gt)})
+	check(2 /* groups */, 2 /* relExprs */, 3 /* scalarExprs */, 0 /* physProps */)
+
+	// Constructing the same expressions again does not add anything.
+	f.ConstructSelect(
+		f.ConstructScan(scanPrivate),
+		memo.FiltersExpr{f.ConstructFiltersItem(
+			f.ConstructGt(f.ConstructVariable(ax), f.ConstructConst(tree.NewDInt(1), types.Int)),
+		)},
+	)
+	check(2 /* groups */, 2 /* relExprs */, 3 /* scalarExprs */, 0 /* physProps */)
+
+	// Physical properties are only counted once per distinct value.
+	for i := 0; i < 2; i++ {
+		f.Memo().InternPhysicalProps(&physical.Required{
+			Ordering: props.ParseOrderingChoice("+1"),
+		})
+	}
+	check(2 /* groups */, 2 /* relExprs */, 3 /* scalarExprs */, 1 /* physProps */)
+
+	if f.MemoStats().MemoryEstimate == 0 {
+		t.Fatal("expected non-zero memory estimate")
+	}
+}
+
+// TestFactoryFormatExpr tests that FormatExpr respects the given flags, that
+// FormatExprOneLine produces a single line, and that formatting does not change
+// the memo.
+func TestFactoryFormatExpr(t *testing.T) {
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+
+	cat := testcat.New()
+	if _, err := cat.ExecuteDDL("CREATE TABLE a (x INT PRIMARY KEY, y INT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	var f norm.Factory
+	f.Init(&evalCtx, cat)
+
+	// SELECT x FROM a WHERE x > 1
+	tn := tree.NewTableNameWithSchema("t", tree.PublicSchemaName, "a")
+	a := f.Metadata().AddTable(cat.Table(tn), tn)
+	ax := a.ColumnID(0)
+	sel := f.ConstructSelect(
+		f.ConstructScan(&memo.ScanPrivate{Table: a, Cols: opt.MakeColSet(ax)}),
+		memo.FiltersExpr{f.ConstructFiltersItem(
+			f.ConstructGt(f.ConstructVariable(ax), f.ConstructConstVal(tree.NewDInt(1), types.Int)),
+		)},
+	)
+
+	stats := f.MemoStats()
+	numCols := f.Metadata().NumColumns()
+
+	testCases := []struct {
+		flags       memo.ExprFmtFlags
+		contains    []string
+		notContains []string
+	}{
+		{
+			flags:    memo.ExprFmtShowAll,
+			contains: []string{"columns: x:1(int!null)", "key: (1)", "variable: x:1"},
+		},
+		{
+			flags:       memo.ExprFmtHideFuncDeps | memo.ExprFmtHideTypes,
+			contains:    []string{"columns: x:1!null"},
+			notContains: []string{"key:", "(int"},
+		},
+		{
+			flags:       memo.ExprFmtHideNotNull | memo.ExprFmtHideTypes,
+			contains:    []string{"columns: x:1\n", "key: (1)"},
+			notContains: []string{"!null"},
+		},
+		{
+			flags:       memo.ExprFmtHideAll &^ memo.ExprFmtHideColumns,
+			contains:    []string{"columns: x:1\n", "x:1 > 1"},
+			notContains: []string{"key:", "stats:", "cost:"},
+		},
+		{
+			flags:       memo.ExprFmtHideAll,
+			contains:    []string{"select\n ├── scan a\n └── filters\n      └── x > 1\n"},
+			notContains: []string{"columns:"},
+		},
+	}
+
+	for _, tc := range testCases {
+		actual := f.FormatExpr(sel, tc.flags)
+		for _, s := range tc.contains {
+			if !strings.Contains(actual, s) {
+				t.Errorf("expected output with flags %d to contain %q, got:\n%s", tc.flags, s, actual)
+			}
+		}
+		for _, s := range tc.notContains {
+			if strings.Contains(actual, s) {
+				t.Errorf("expected output with flags %d not to contain %q, got:\n%s", tc.flags, s, actual)
+			}
+		}
+	}
+
+	const expected = "(Select (Scan a) [(Gt (Variable a.x) (Const 1))])"
+	if actual := f.FormatExprOneLine(sel); actual != expected {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+
+	if actual := f.MemoStats(); actual != stats {
+		t.Errorf("expected formatting not to change memo stats %+v, got %+v", stats, actual)
+	}
+	if actual := f.Metadata().NumColumns(); actual != numCols {
+		t.Errorf("expected formatting not to add columns, got %d instead of %d", actual, numCols)
+	}
+}
+
+// TestAssignPlaceholdersErrors tests that AssignPlaceholders returns an error
+// when a placeholder has no value or a value of the wrong type.
+func TestAssignPlaceholdersErrors(t *testing.T) {
+	cat := testcat.New()
+	if _, err := cat.ExecuteDDL("CREATE TABLE kv (k INT PRIMARY KEY, v INT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+
+	var o xform.Optimizer
+	testutils.BuildQuery(t, &o, cat, &evalCtx, "SELECT v FROM kv WHERE k = $1")
+	m := o.Factory().DetachMemo()
+
+	var f norm.Factory
+	f.Init(&evalCtx, cat)
+	err := f.AssignPlaceholders(m)
+	if err == nil || !strings.Contains(err.Error(), "no value provided for placeholder: $1") {
+		t.Fatalf("expected missing value error, got %v", err)
+	}
+
+	evalCtx.Placeholders = &tree.PlaceholderInfo{
+		PlaceholderTypesInfo: tree.PlaceholderTypesInfo{
+			Types: tree.PlaceholderTypes{types.String},
+		},
+		Values: tree.QueryArguments{tree.NewDString("5")},
+	}
+	f.Init(&evalCtx, cat)
+	err = f.AssignPlaceholders(m)
+	if err == nil || !strings.Contains(err.Error(), "value for placeholder $1 has type string, expected int") {
+		t.Fatalf("expected type mismatch error, got %v", err)
+	}
+}
+
+func TestConstructConstVal(t *testing.T) {
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+
+	var f norm.Factory
+	f.Init(&evalCtx, testcat.New())
+
+	// Identical datums are interned to the same expression.
+	c1 := f.ConstructConstVal(tree.NewDInt(5), types.Int)
+	c2 := f.ConstructConstVal(tree.NewDInt(5), types.Int)
+	if c1 != c2 {
+		t.Fatalf("expected %v and %v to be interned to the same expression", c1, c2)
+	}
+	if c1.Op() != opt.ConstOp {
+		t.Fatalf("expected Const, got %v", c1.Op())
+	}
+	if c3 := f.ConstructConstVal(tree.NewDInt(6), types.Int); c3 == c1 {
+		t.Fatalf("expected %v and %v to be distinct expressions", c1, c3)
+	}
+
+	// Bool datums map to the True and False singletons.
+	if e := f.ConstructConstVal(tree.DBoolTrue, types.Bool); e != memo.TrueSingleton {
+		t.Fatalf("expected True, got %v", e)
+	}
+	if e := f.ConstructConstVal(tree.DBoolFalse, types.Bool); e != memo.FalseSingleton {
+		t.Fatalf("expected False, got %v", e)
+	}
+	if f.ConstructBoolVal(true) != memo.TrueSingleton || f.ConstructBoolVal(false) != memo.FalseSingleton {
+		t.Fatal("expected ConstructBoolVal to return the True and False singletons")
+	}
+
+	// Nulls are interned by type.
+	n1 := f.ConstructNullOfType(types.Int)
+	n2 := f.ConstructConstVal(tree.DNull, types.Int)
+	if n1 != n2 {
+		t.Fatalf("expected %v and %v to be interned to the same expression", n1, n2)
+	}
+	if !n1.DataType().Identical(types.Int) {
+		t.Fatalf("expected Null of type INT, got %s", n1.DataType())
+	}
+	if n3 := f.ConstructNullOfType(types.String); n3 == n1 {
+		t.Fatalf("expected Nulls of different types to be distinct expressions")
+	}
+}
+
+func TestConstructEmptyRelation(t *testing.T) {
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+
+	var f norm.Factory
+	f.Init(&evalCtx, testcat.New())
+	md := f.Metadata()
+	x := md.AddColumn("x", types.Int)
+	md.AddColumn("y", types.String)
+	z := md.AddColumn("z", types.Float)
+	cols := opt.MakeColSet(x, z)
+
+	rel := f.ConstructEmptyRelation(cols)
+	if rel.Op() != opt.ValuesOp {
+		t.Fatalf("expected Values, got %s", rel.Op())
+	}
+	relProps := rel.Relational()
+	if !relProps.OutputCols.Equals(cols) {
+		t.Fatalf("expected output columns %s, got %s", cols, relProps.OutputCols)
+	}
+	if !relProps.Cardinality.IsZero() {
+		t.Fatalf("expected zero cardinality, got %s", relProps.Cardinality)
+	}
+	if !relProps.NotNullCols.Equals(cols) {
+		t.Fatalf("expected not-null columns %s, got %s", cols, relProps.NotNullCols)
+	}
+
+	// The relation has no columns if the column set is empty.
+	if rel := f.ConstructEmptyRelation(opt.ColSet{}); !rel.Relational().OutputCols.Empty() {
+		t.Fatalf("expected no output columns, got %s", rel.Relational().OutputCols)
+	}
+
+	// Empty relations with the same columns are the same expression, while
+	// those without columns are distinct.
+	if f.ConstructEmptyRelation(cols) != rel {
+		t.Fatalf("expected empty relations with the same columns to be interned")
+	}
+	if f.ConstructEmptyRelation(opt.ColSet{}) == f.ConstructEmptyRelation(opt.ColSet{}) {
+		t.Fatalf("expected empty relations without columns to be distinct")
+	}
+}
+
+// TestEmptyRelationDedup tests that different rules that produce an empty
+// relation with the same columns produce the same memo group.
+func TestEmptyRelationDedup(t *testing.T) {
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+
+	cat := testcat.New()
+	if _, err := cat.ExecuteDDL("CREATE TABLE a (x INT PRIMARY KEY, y INT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	var f norm.Factory
+	f.Init(&evalCtx, cat)
+
+	var applied []opt.RuleName
+	f.NotifyOnAppliedRule(func(ruleName opt.RuleName, source, target opt.Expr) {
+		applied = append(applied, ruleName)
+	})
+
+	tn := tree.NewTableNameWithSchema("t", tree.PublicSchemaName, "a")
+	a := f.Metadata().AddTable(cat.Table(tn), tn)
+	scan := f.ConstructScan(&memo.ScanPrivate{
+		Table: a, Cols: opt.MakeColSet(a.ColumnID(0), a.ColumnID(1)),
+	})
+
+	// EliminateSelectFalse.
+	sel := f.ConstructSelect(scan, memo.FiltersExpr{f.ConstructFiltersItem(memo.FalseSingleton)})
+
+	// SimplifyZeroCardinalitySemiJoin.
+	empty := f.ConstructValuesFromDatums(nil /* rows */, opt.ColList{f.Metadata().AddColumn("z", types.Int)})
+	semi := f.ConstructSemiJoin(scan, empty, memo.TrueFilter, memo.EmptyJoinPrivate)
+
+	for _, rule := range []opt.RuleName{opt.EliminateSelectFalse, opt.SimplifyZeroCardinalitySemiJoin} {
+		found := false
+		for _, r := range applied {
+			found = found || r == rule
+		}
+		if !found {
+			t.Fatalf("expected rule %s to be applied, got %v", rule, applied)
+		}
+	}
+	if sel.Op() != opt.ValuesOp || sel != semi {
+		t.Fatalf("expected both rules to produce the same empty Values expression")
+	}
+}
+
+func TestAssertNormalized(t *testing.T) {
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+
+	cat := testcat.New()
+	if _, err := cat.ExecuteDDL("CREATE TABLE a (x INT PRIMARY KEY, y INT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	var f norm.Factory
+	f.Init(&evalCtx, cat)
+
+	tn := tree.NewTableNameWithSchema("t", tree.PublicSchemaName, "a")
+	a := f.Metadata().AddTable(cat.Table(tn), tn)
+	ay := a.ColumnID(1)
+
+	var applied []opt.RuleName
+	f.NotifyOnAppliedRule(func(ruleName opt.RuleName, source, target opt.Expr) {
+		applied = append(applied, ruleName)
+	})
+
+	// Construct NOT (y = 1) inside a Select with rules disabled, so that it is
+	// not normalized to y != 1.
+	f.DisableOptimizations()
+	scan := f.ConstructScan(&memo.ScanPrivate{Table: a, Cols: opt.MakeColSet(a.ColumnID(0), ay)})
+	not := f.ConstructNot(f.ConstructEq(f.ConstructVariable(ay), f.ConstructConst(tree.NewDInt(1), types.Int)))
+	sel := f.ConstructSelect(scan, memo.FiltersExpr{f.ConstructFiltersItem(not)})
+	f.NotifyOnMatchedRule(nil)
+
+	// The innermost expression that is not normalized is reported.
+	if ruleName, ok := f.AssertNormalized(sel); ok || ruleName != opt.NegateComparison {
+		t.Fatalf("expected NegateComparison to match, got %v (ok=%t)", ruleName, ok)
+	}
+	if len(applied) != 0 {
+		t.Fatalf("expected no rules to be applied by the check, got %v", applied)
+	}
+
+	// The check does not disable rules once it has completed.
+	ne := f.ConstructNot(f.ConstructEq(f.ConstructVariable(ay), f.ConstructConst(tree.NewDInt(2), types.Int)))
+	if ne.Op() != opt.NeOp {
+		t.Fatalf("expected NOT (y = 2) to be normalized to Ne, got %v", ne.Op())
+	}
+
+	// Expressions constructed with rules enabled are normalized.
+	sel = f.ConstructSelect(scan, memo.FiltersExpr{f.ConstructFiltersItem(ne)})
+	if ruleName, ok := f.AssertNormalized(sel); !ok {
+		t.Fatalf("expected expression to be normalized, but %v matched", ruleName)
+	}
+}
@@ -148,13 +148,13 @@ func (c *CustomFuncs) CanFoldOperator(v tree.Volatility) bool {
 // FoldNullUnary replaces the unary operator with a typed null value having the
 // same type as the unary operator would have.
 func (c *CustomFuncs) FoldNullUnary(op opt.Operator, input opt.ScalarExpr) opt.ScalarExpr {
-	return c.f.ConstructNull(memo.InferUnaryType(op, input.DataType()))
+	return c.f.ConstructNullOfType(memo.InferUnaryType(op, input.DataType()))
 }
 
 // FoldNullBinary replaces the binary operator with a typed null value having
 // the same type as the binary operator would have.
 func (c *CustomFuncs) FoldNullBinary(op opt.Operator, left, right opt.ScalarExpr) opt.ScalarExpr {
-	return c.f.ConstructNull(memo.InferBinaryType(op, left.DataType(), right.DataType()))
+	return c.f.ConstructNullOfType(memo.InferBinaryType(op, left.DataType(), right.DataType()))
 }
 
 // AllowNullArgs returns true if the binary operator with the given inputs
@@ -277,7 +277,10 @@ func (c *CustomFuncs) HasAllNonNullElements(tup *memo.TupleExpr) bool {
 // FoldBinary evaluates a binary expression with constant inputs. It returns
 // a constant expression as long as it finds an appropriate overload function
 // for the given operator and input types, and the evaluation causes no error.
-// Otherwise, it returns ok=false.
+// Otherwise, it returns ok=false. In particular, integer arithmetic that would
+// overflow the INT type is never folded, since its evaluation returns an out of
+// range error. The expression is left as-is, so that the error is raised at
+// execution time if the expression is actually evaluated.
 func (c *CustomFuncs) FoldBinary(
 	op opt.Operator, left, right opt.ScalarExpr,
 ) (_ opt.ScalarExpr, ok bool) {
@@ -460,10 +463,10 @@ func (c *CustomFuncs) FoldIndirection(input, index opt.ScalarExpr) (_ opt.Scalar
 			if indexI >= 0 && indexI < len(arr.Elems) {
 				return arr.Elems[indexI], true
 			}
-			return c.f.ConstructNull(arr.Typ.ArrayContents()), true
+			return c.f.ConstructNullOfType(arr.Typ.ArrayContents()), true
 		}
 		if indexD == tree.DNull {
-			return c.f.ConstructNull(arr.Typ.ArrayContents()), true
+			return c.f.ConstructNullOfType(arr.Typ.ArrayContents()), true
 		}
 		return nil, false
 	}
@@ -492,17 +495,31 @@ func (c *CustomFuncs) FoldColumnAccess(
 	// already folded an Indirection expression with an out-of-bounds index to
 	// Null.
 	if n, ok := input.(*memo.NullExpr); ok {
-		return c.f.ConstructNull(n.Typ.TupleContents()[idx]), true
+		contents := n.Typ.TupleContents()
+		if int(idx) >= len(contents) {
+			return nil, false
+		}
+		return c.f.ConstructNullOfType(contents[idx]), true
 	}
 
-	// Case 2: The input is a static tuple constructor.
+	// Case 2: The input is a static tuple constructor, possibly wrapped in a
+	// cast that only changes the tuple labels.
+	if cast, ok := input.(*memo.CastExpr); ok && c.isTupleLabelCast(cast) {
+		input = cast.Input
+	}
 	if tup, ok := input.(*memo.TupleExpr); ok {
+		if int(idx) >= len(tup.Elems) {
+			return nil, false
+		}
 		return tup.Elems[idx], true
 	}
 
 	// Case 3: The input is a constant DTuple.
 	if memo.CanExtractConstDatum(input) {
 		datum := memo.ExtractConstDatum(input)
+		if tup, ok := datum.(*tree.DTuple); !ok || int(idx) >= len(tup.D) {
+			return nil, false
+		}
 
 		texpr := tree.NewTypedColumnAccessExpr(datum, "" /* by-index access */, int(idx))
 		result, err := texpr.Eval(c.f.evalCtx)
@@ -514,6 +531,26 @@ func (c *CustomFuncs) FoldColumnAccess(
 	return nil, false
 }
 
+// isTupleLabelCast returns true if the given cast converts between two tuple
+// types that differ only in their labels. Such a cast does not change the
+// tuple elements.
+func (c *CustomFuncs) isTupleLabelCast(cast *memo.CastExpr) bool {
+	from, to := cast.Input.DataType(), cast.Typ
+	if from.Family() != types.TupleFamily || to.Family() != types.TupleFamily {
+		return false
+	}
+	fromContents, toContents := from.TupleContents(), to.TupleContents()
+	if len(fromContents) != len(toContents) {
+		return false
+	}
+	for i := range fromContents {
+		if !fromContents[i].Identical(toContents[i]) {
+			return false
+		}
+	}
+	return true
+}
+
 // CanFoldFunctionWithNullArg returns true if the given function can be folded
 // to Null when any of its arguments are Null. A function can be folded to Null
 // in this case if all of the following are true:
@@ -530,7 +567,7 @@ func (c *CustomFuncs) CanFoldFunctionWithNullArg(private *memo.FunctionPrivate)
 // HasNullArg returns true if one of args is Null.
 func (c *CustomFuncs) HasNullArg(args memo.ScalarListExpr) bool {
 	for i := range args {
-		if args[i].Op() == opt.NullOp {
+		if isNull(args[i]) {
 			return true
 		}
 	}
@@ -11,6 +11,8 @@
 package norm
 
 import (
+	"math"
+
 	"github.com/cockroachdb/apd/v2"
 	"github.com/cockroachdb/cockroach/pkg/sql/opt"
 	"github.com/cockroachdb/cockroach/pkg/sql/opt/cat"
@@ -53,6 +55,45 @@ func (c *CustomFuncs) HasColType(scalar opt.ScalarExpr, dstTyp *types.T) bool {
 	return scalar.DataType().Identical(dstTyp)
 }
 
+// CanOmitCast returns true if casting the given scalar expression to the target
+// type cannot change its value, though it may change the type reported for it.
+// This is the case for casts that widen an integer, for casts from STRING or
+// VARCHAR to STRING or VARCHAR with no width, and for casts to a DECIMAL with
+// no precision.
+// Casts that can round or truncate the value, such as DECIMAL to DECIMAL(10,2)
+// or STRING to VARCHAR(2), or that convert it to another type family, cannot
+// be omitted. Because the reported type may still change, callers must only
+// discard such a cast where its type is not visible, such as in an operand of
+// a comparison.
+func (c *CustomFuncs) CanOmitCast(scalar opt.ScalarExpr, targetTyp *types.T) bool {
+	typ := scalar.DataType()
+	if typ.Identical(targetTyp) {
+		return true
+	}
+	if typ.Family() != targetTyp.Family() {
+		return false
+	}
+	switch typ.Family() {
+	case types.IntFamily:
+		return typ.Width() <= targetTyp.Width()
+
+	case types.StringFamily:
+		return isStringOrVarChar(typ) &&
+			(targetTyp.Identical(c.StringType()) || targetTyp.Identical(types.VarChar))
+
+	case types.DecimalFamily:
+		return targetTyp.Identical(c.DecimalType())
+	}
+	return false
+}
+
+// isStringOrVarChar returns true if the given type is STRING or VARCHAR, with
+// or without a width. CHAR and the other STRING family types are excluded,
+// since their values can be padded or trimmed by a cast.
+func isStringOrVarChar(typ *types.T) bool {
+	return typ.Oid() == types.String.Oid() || typ.Oid() == types.VarChar.Oid()
+}
+
 // IsTimestamp returns true if the given scalar expression is of type Timestamp.
 func (c *CustomFuncs) IsTimestamp(scalar opt.ScalarExpr) bool {
 	return scalar.DataType().Family() == types.TimestampFamily
@@ -69,6 +110,26 @@ func (c *CustomFuncs) BoolType() *types.T {
 	return types.Bool
 }
 
+// IntType returns the INT SQL type.
+func (c *CustomFuncs) IntType() *types.T {
+	return types.Int
+}
+
+// FloatType returns the FLOAT SQL type.
+func (c *CustomFuncs) FloatType() *types.T {
+	return types.Float
+}
+
+// StringType returns the STRING SQL type.
+func (c *CustomFuncs) StringType() *types.T {
+	return types.String
+}
+
+// DecimalType returns the DECIMAL SQL type, with no precision or scale.
+func (c *CustomFuncs) DecimalType() *types.T {
+	return types.Decimal
+}
+
 // AnyType returns the wildcard Any type.
 func (c *CustomFuncs) AnyType() *types.T {
 	return types.Any
@@ -160,6 +221,20 @@ func (c *CustomFuncs) NotNullCols(input memo.RelExpr) opt.ColSet {
 	return input.Relational().NotNullCols
 }
 
+// NullableCols returns the set of columns returned by the input expression that
+// may contain NULL values.
+func (c *CustomFuncs) NullableCols(input memo.RelExpr) opt.ColSet {
+	rel := input.Relational()
+	return rel.OutputCols.Difference(rel.NotNullCols)
+}
+
+// HasNullableCols returns true if at least one of the columns returned by the
+// input expression may contain NULL values.
+func (c *CustomFuncs) HasNullableCols(input memo.RelExpr) bool {
+	rel := input.Relational()
+	return !rel.OutputCols.SubsetOf(rel.NotNullCols)
+}
+
 // IsColNotNull returns true if the given input column is never null.
 func (c *CustomFuncs) IsColNotNull(col opt.ColumnID, input memo.RelExpr) bool {
 	return input.Relational().NotNullCols.Contains(col)
@@ -520,6 +595,17 @@ func (c *CustomFuncs) ColsAreStrictKey(cols opt.ColSet, input memo.RelExpr) bool
 	return input.Relational().FuncDeps.ColsAreStrictKey(cols)
 }
 
+// ColsAreLaxKey returns true if the given columns form a lax key for the given
+// input expression. A lax key means that any two rows will have unique key
+// column values, except potentially when at least one of the key columns is
+// NULL. The not-null columns of the input are taken into account, since a
+// not-null column that is functionally determined by the given columns can be
+// used to reach a key that would otherwise be out of reach.
+func (c *CustomFuncs) ColsAreLaxKey(cols opt.ColSet, input memo.RelExpr) bool {
+	rel := input.Relational()
+	return rel.FuncDeps.ColsAreLaxKeyWithNotNull(cols, rel.NotNullCols)
+}
+
 // PrimaryKeyCols returns the key columns of the primary key of the table.
 func (c *CustomFuncs) PrimaryKeyCols(table opt.TableID) opt.ColSet {
 	tabMeta := c.mem.Metadata().TableMeta(table)
@@ -540,6 +626,38 @@ func (c *CustomFuncs) ExprIsNeverNull(e opt.ScalarExpr, notNullCols opt.ColSet)
 	return memo.ExprIsNeverNull(e, notNullCols)
 }
 
+// IsLeakProof returns true if the given relational expression contains only
+// leak-proof operators. Such an expression can be discarded without hiding an
+// error or side effect that it would have produced during execution.
+func (c *CustomFuncs) IsLeakProof(input memo.RelExpr) bool {
+	return input.Relational().VolatilitySet.IsLeakProof()
+}
+
+// IsNonVolatileConstExpr returns true if the given scalar expression is a
+// constant expression tree that contains no volatile operators. A constant
+// expression tree has no outer columns, though it may contain stable functions
+// like now(), placeholders, or uncorrelated subqueries. Volatile operators such
+// as random(), nextval(), or crdb_internal.force_error() are excluded, so such
+// an expression evaluates to the same result every time within a statement, and
+// has no side effects. It is therefore safe to reorder, evaluate early, or
+// evaluate more than once.
+func (c *CustomFuncs) IsNonVolatileConstExpr(e opt.ScalarExpr) bool {
+	switch e.Op() {
+	case opt.VariableOp:
+		return false
+	case opt.ConstOp, opt.NullOp, opt.TrueOp, opt.FalseOp:
+		return true
+	}
+	return c.sharedProps(e).OuterCols.Empty() && c.IsNonVolatile(e)
+}
+
+// IsNonVolatile returns true if the given scalar expression contains no
+// volatile operators. Unlike IsNonVolatileConstExpr, the expression may refer
+// to outer columns.
+func (c *CustomFuncs) IsNonVolatile(e opt.ScalarExpr) bool {
+	return !c.sharedProps(e).VolatilitySet.HasVolatile()
+}
+
 // sharedProps returns the shared logical properties for the given expression.
 // Only relational expressions and certain scalar list items (e.g. FiltersItem,
 // ProjectionsItem, AggregationsItem) have shared properties.
@@ -556,6 +674,22 @@ func (c *CustomFuncs) sharedProps(e opt.Expr) *props.Shared {
 	}
 }
 
+// isTrue returns true if the given scalar expression is the True constant.
+func isTrue(e opt.ScalarExpr) bool {
+	return e.Op() == opt.TrueOp
+}
+
+// isFalse returns true if the given scalar expression is the False constant.
+func isFalse(e opt.ScalarExpr) bool {
+	return e.Op() == opt.FalseOp
+}
+
+// isNull returns true if the given scalar expression is the Null constant, of
+// any type.
+func isNull(e opt.ScalarExpr) bool {
+	return e.Op() == opt.NullOp
+}
+
 // ----------------------------------------------------------------------
 //
 // Ordering functions
@@ -673,6 +807,17 @@ func (c *CustomFuncs) ConcatFilters(left, right memo.FiltersExpr) memo.FiltersEx
 	return newFilters
 }
 
+// MergeFilters is similar to ConcatFilters, except that it omits any condition
+// from the right filters that is already present in the left filters. If there
+// are no new conditions, the original left filters are returned.
+func (c *CustomFuncs) MergeFilters(left, right memo.FiltersExpr) memo.FiltersExpr {
+	newRight := right.Difference(left)
+	if len(newRight) == 0 {
+		return left
+	}
+	return c.ConcatFilters(left, newRight)
+}
+
 // DiffFilters creates new Filters that contains all conditions in left that do
 // not exist in right. If right is empty, the original left filters are
 // returned.
@@ -680,6 +825,58 @@ func (c *CustomFuncs) DiffFilters(left, right memo.FiltersExpr) memo.FiltersExpr
 	return left.Difference(right)
 }
 
+// appendEquivGroupFilters appends equality filters to the given list that
+// imply that all columns in the given group are equivalent. Rather than
+// equating every pair of columns, the equalities form a spanning tree of the
+// group: the lowest column is equated with each of the other columns. A group
+// of N columns therefore results in N-1 equalities rather than N*(N-1)/2, and
+// a group of a single column results in none. For example, the group
+// {a, b, c} results in:
+//
+//   a = b AND a = c
+//
+func (c *CustomFuncs) appendEquivGroupFilters(
+	filters memo.FiltersExpr, cols opt.ColSet,
+) memo.FiltersExpr {
+	first, ok := cols.Next(0)
+	if !ok {
+		return filters
+	}
+	for col, ok := cols.Next(first + 1); ok; col, ok = cols.Next(col + 1) {
+		filters = append(filters, c.f.ConstructFiltersItem(
+			c.f.ConstructEq(c.f.ConstructVariable(first), c.f.ConstructVariable(col)),
+		))
+	}
+	return filters
+}
+
+// appendUnimpliedEquivFilters is similar to appendEquivGroupFilters, except
+// that it omits any equality that is already implied by the equivalencies in
+// the given FD set. For example, if the FD set contains (a)==(b), then the
+// group {a, b, c} results in:
+//
+//   a = c
+//
+func (c *CustomFuncs) appendUnimpliedEquivFilters(
+	filters memo.FiltersExpr, cols opt.ColSet, fd *props.FuncDepSet,
+) memo.FiltersExpr {
+	first, ok := cols.Next(0)
+	if !ok {
+		return filters
+	}
+	implied := fd.ComputeEquivGroup(first)
+	for col, ok := cols.Next(first + 1); ok; col, ok = cols.Next(col + 1) {
+		if implied.Contains(col) {
+			continue
+		}
+		filters = append(filters, c.f.ConstructFiltersItem(
+			c.f.ConstructEq(c.f.ConstructVariable(first), c.f.ConstructVariable(col)),
+		))
+		implied.UnionWith(fd.ComputeEquivGroup(col))
+	}
+	return filters
+}
+
 // RemoveFiltersItem returns a new list that is a copy of the given list, except
 // that it does not contain the given search item. If the list contains the item
 // multiple times, then only the first instance is removed. If the list does not
@@ -726,6 +923,11 @@ func (c *CustomFuncs) ReplaceFiltersItem(
 // Calling ExtractBoundConditions with the filter conditions list and the output
 // columns of (Scan a) would extract the (Gt) expression, since its outer
 // references only reference columns from a.
+//
+// Each filter item is treated atomically. Conjunctions never need to be split
+// here, since SimplifySelectFilters and SimplifyJoinFilters flatten any And
+// condition into separate filter items before the rules that call this
+// function can match.
 func (c *CustomFuncs) ExtractBoundConditions(
 	filters memo.FiltersExpr, cols opt.ColSet,
 ) memo.FiltersExpr {
@@ -764,11 +966,7 @@ func (c *CustomFuncs) ExtractUnboundConditions(
 // ProjectionCols returns the ids of the columns synthesized by the given
 // Projections operator.
 func (c *CustomFuncs) ProjectionCols(projections memo.ProjectionsExpr) opt.ColSet {
-	var colSet opt.ColSet
-	for i := range projections {
-		colSet.Add(projections[i].Col)
-	}
-	return colSet
+	return projections.OutputCols()
 }
 
 // ProjectExtraCol constructs a new Project operator that passes through all
@@ -793,16 +991,31 @@ func (c *CustomFuncs) ValuesCols(valuesPrivate *memo.ValuesPrivate) opt.ColList
 	return valuesPrivate.Cols
 }
 
-// ConstructEmptyValues constructs a Values expression with no rows.
+// ConstructEmptyValues constructs a Values expression with no rows. See
+// Factory.ConstructEmptyRelation.
 func (c *CustomFuncs) ConstructEmptyValues(cols opt.ColSet) memo.RelExpr {
-	colList := make(opt.ColList, 0, cols.Len())
-	for i, ok := cols.Next(0); ok; i, ok = cols.Next(i + 1) {
-		colList = append(colList, i)
+	return c.f.ConstructEmptyRelation(cols)
+}
+
+// extractValuesRows returns the constant value of every element of the given
+// Values operator, indexed first by row and then by column ordinal. It returns
+// ok=false if any element is not a constant value.
+func (c *CustomFuncs) extractValuesRows(values *memo.ValuesExpr) (_ []tree.Datums, ok bool) {
+	rows := make([]tree.Datums, len(values.Rows))
+	for i, scalar := range values.Rows {
+		tup := scalar.(*memo.TupleExpr)
+		row := make(tree.Datums, len(tup.Elems))
+		for j, elem := range tup.Elems {
+			// Call IsConstValueOp first, since callers don't expect the tuples
+			// and arrays that ExtractConstDatum can return.
+			if !opt.IsConstValueOp(elem) {
+				return nil, false
+			}
+			row[j] = memo.ExtractConstDatum(elem)
+		}
+		rows[i] = row
 	}
-	return c.f.ConstructValues(memo.EmptyScalarListExpr, &memo.ValuesPrivate{
-		Cols: colList,
-		ID:   c.mem.Metadata().NextUniqueID(),
-	})
+	return rows, true
 }
 
 // ----------------------------------------------------------------------
@@ -989,7 +1202,12 @@ func (c *CustomFuncs) EqualsString(left string, right string) bool {
 }
 
 // EqualsNumber returns true if the given numeric value (decimal, float, or
-// integer) is equal to the given integer value.
+// integer) is equal to the given integer value. The comparison is by value:
+// -0.0 and 0.00 are both equal to 0, and 1.00 is equal to 1. Rules that rely
+// on the constant being an exact identity should use IsAdditiveIdentity,
+// IsSubtractiveIdentity or IsExactOne instead. Optgen uses EqualsNumber to
+// match numeric literals in patterns like (Const 0), which is fine for rules
+// such as EliminateOffset and DecorrelateLimitOne that only match integers.
 func (c *CustomFuncs) EqualsNumber(datum tree.Datum, value int64) bool {
 	switch t := datum.(type) {
 	case *tree.DDecimal:
@@ -1011,6 +1229,94 @@ func (c *CustomFuncs) EqualsNumber(datum tree.Datum, value int64) bool {
 	return false
 }
 
+// IsAdditiveIdentity returns true if the given numeric value is a zero that is
+// an exact additive identity, so that x + 0 and 0 + x can be replaced by x
+// without changing the result. It is stricter than EqualsNumber(datum, 0):
+//
+//   - a float zero must be negative, since x + -0.0 = x for all x, whereas
+//     -0.0 + 0.0 = 0.0.
+//   - a decimal zero must be non-negative and have a zero exponent, since
+//     adding 0.00 changes the scale of the result (1 + 0.00 = 1.00).
+//
+// NaN is never a zero. IsAdditiveIdentity is used by FoldPlusZero and
+// FoldZeroPlus.
+func (c *CustomFuncs) IsAdditiveIdentity(datum tree.Datum) bool {
+	switch t := datum.(type) {
+	case *tree.DFloat:
+		return *t == 0 && math.Signbit(float64(*t))
+	}
+	return c.isExactDecimalOrIntZero(datum)
+}
+
+// IsSubtractiveIdentity returns true if the given numeric value is a zero that
+// can be subtracted from any x without changing it, so that x - 0 can be
+// replaced by x. It is stricter than EqualsNumber(datum, 0):
+//
+//   - a float zero must be positive, since x - 0.0 = x for all x, whereas
+//     -0.0 - -0.0 = 0.0.
+//   - a decimal zero must be non-negative and have a zero exponent, since
+//     subtracting 0.00 changes the scale of the result (1 - 0.00 = 1.00).
+//
+// NaN is never a zero. IsSubtractiveIdentity is used by FoldMinusZero.
+func (c *CustomFuncs) IsSubtractiveIdentity(datum tree.Datum) bool {
+	switch t := datum.(type) {
+	case *tree.DFloat:
+		return *t == 0 && !math.Signbit(float64(*t))
+	}
+	return c.isExactDecimalOrIntZero(datum)
+}
+
+// isExactDecimalOrIntZero returns true if the given value is an integer zero,
+// or a non-negative decimal zero with a zero exponent.
+func (c *CustomFuncs) isExactDecimalOrIntZero(datum tree.Datum) bool {
+	switch t := datum.(type) {
+	case *tree.DDecimal:
+		return t.Decimal.IsZero() && !t.Decimal.Negative && t.Decimal.Exponent == 0
+
+	case *tree.DInt:
+		return *t == 0
+	}
+	return false
+}
+
+// IsExactOne returns true if the given numeric value is a one that is an
+// exact multiplicative identity, so that x * 1 and x / 1 can be replaced by x
+// without changing the result. It is stricter than EqualsNumber(datum, 1): a
+// decimal one must have a zero exponent, since multiplying by 1.00 changes the
+// scale of the result (2 * 1.00 = 2.00). IsExactOne is used by FoldMultOne,
+// FoldOneMult, and FoldDivOne.
+func (c *CustomFuncs) IsExactOne(datum tree.Datum) bool {
+	switch t := datum.(type) {
+	case *tree.DDecimal:
+		d := &t.Decimal
+		return d.Form == apd.Finite && !d.Negative && d.Exponent == 0 &&
+			d.Coeff.IsInt64() && d.Coeff.Int64() == 1
+
+	case *tree.DFloat:
+		return *t == 1
+
+	case *tree.DInt:
+		return *t == 1
+	}
+	return false
+}
+
+// CanReassociateConsts returns true if an expression of the form
+// (input op left) op right, where op is Plus or Mult, can be rewritten as
+// input op (left op right) without changing its type or value (other than by
+// avoiding an overflow error). This is the case if all three operands have
+// identical INT or DECIMAL types. Floating point arithmetic is not associative,
+// since the intermediate result is rounded, so FLOAT operands are rejected.
+// CanReassociateConsts is used by AssociatePlusConsts and AssociateMultConsts.
+func (c *CustomFuncs) CanReassociateConsts(input, left, right opt.ScalarExpr) bool {
+	typ := input.DataType()
+	switch typ.Family() {
+	case types.IntFamily, types.DecimalFamily:
+		return typ.Identical(left.DataType()) && typ.Identical(right.DataType())
+	}
+	return false
+}
+
 // AddConstInts adds the numeric constants together and constructs a Const.
 // AddConstInts assumes the sum will not overflow. Call CanAddConstInts on the
 // constants to guarantee this.
@@ -1021,7 +1327,7 @@ func (c *CustomFuncs) AddConstInts(first tree.Datum, second tree.Datum) opt.Scal
 	if !ok {
 		panic(errors.AssertionFailedf("addition of %d and %d overflowed", firstVal, secondVal))
 	}
-	return c.f.ConstructConst(tree.NewDInt(tree.DInt(sum)), types.Int)
+	return c.f.ConstructConst(tree.NewDInt(tree.DInt(sum)), c.IntType())
 }
 
 // CanAddConstInts returns true if the addition of the two integers overflows.
@@ -1034,7 +1340,7 @@ func (c *CustomFuncs) CanAddConstInts(first tree.Datum, second tree.Datum) bool
 
 // IntConst constructs a Const holding a DInt.
 func (c *CustomFuncs) IntConst(d *tree.DInt) opt.ScalarExpr {
-	return c.f.ConstructConst(d, types.Int)
+	return c.f.ConstructConst(d, c.IntType())
 }
 
 // IsGreaterThan returns true if the first datum compares as greater than the
@@ -13,7 +13,11 @@ package norm
 import (
 	"testing"
 
+	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt"
 	"github.com/cockroachdb/cockroach/pkg/sql/opt/memo"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/sql/types"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 )
 
@@ -76,3 +80,36 @@ func TestCommuteJoinFlags(t *testing.T) {
 		}
 	}
 }
+
+func TestIsTrueFalseNull(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+	var f Factory
+	f.Init(&evalCtx, nil /* catalog */)
+
+	cases := []struct {
+		expr                  opt.ScalarExpr
+		isTrue, isFalse, null bool
+	}{
+		{expr: memo.TrueSingleton, isTrue: true},
+		{expr: memo.FalseSingleton, isFalse: true},
+		{expr: memo.NullSingleton, null: true},
+		{expr: f.ConstructNullOfType(types.Int), null: true},
+		{expr: f.ConstructConstVal(tree.DBoolTrue, types.Bool), isTrue: true},
+		{expr: f.ConstructConstVal(tree.NewDInt(1), types.Int)},
+		{expr: f.ConstructNot(memo.TrueSingleton), isFalse: true},
+	}
+
+	for _, tc := range cases {
+		if actual := isTrue(tc.expr); actual != tc.isTrue {
+			t.Errorf("%s: expected isTrue=%t, got %t", tc.expr, tc.isTrue, actual)
+		}
+		if actual := isFalse(tc.expr); actual != tc.isFalse {
+			t.Errorf("%s: expected isFalse=%t, got %t", tc.expr, tc.isFalse, actual)
+		}
+		if actual := isNull(tc.expr); actual != tc.null {
+			t.Errorf("%s: expected isNull=%t, got %t", tc.expr, tc.null, actual)
+		}
+	}
+}
@@ -11,11 +11,14 @@
 package norm
 
 import (
+	"github.com/cockroachdb/apd/v2"
 	"github.com/cockroachdb/cockroach/pkg/sql/opt"
 	"github.com/cockroachdb/cockroach/pkg/sql/opt/memo"
 	"github.com/cockroachdb/cockroach/pkg/sql/opt/props"
 	"github.com/cockroachdb/cockroach/pkg/sql/rowenc"
 	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/sql/types"
+	"github.com/cockroachdb/cockroach/pkg/util/arith"
 	"github.com/cockroachdb/cockroach/pkg/util/encoding"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/errors"
@@ -105,6 +108,321 @@ func (c *CustomFuncs) ReplaceAggregationsItem(
 	panic(errors.AssertionFailedf("item to replace is not in the list: %v", search))
 }
 
+// CanFoldCountRows returns true if every aggregate in the given list is a
+// CountRows aggregate, and the input is known to return an exact number of rows
+// (i.e. its minimum and maximum cardinality are equal). In that case, the result
+// of each aggregate is statically known.
+func (c *CustomFuncs) CanFoldCountRows(input memo.RelExpr, aggs memo.AggregationsExpr) bool {
+	card := input.Relational().Cardinality
+	if card.Min != card.Max {
+		return false
+	}
+	for i := range aggs {
+		if aggs[i].Agg.Op() != opt.CountRowsOp {
+			return false
+		}
+	}
+	return true
+}
+
+// FoldCountRows returns a single-row Values expression that contains the
+// result of each CountRows aggregate in the given list. It should only be
+// called if CanFoldCountRows returns true.
+func (c *CustomFuncs) FoldCountRows(input memo.RelExpr, aggs memo.AggregationsExpr) memo.RelExpr {
+	count := c.f.ConstructConstVal(
+		tree.NewDInt(tree.DInt(input.Relational().Cardinality.Min)), c.IntType(),
+	)
+	cols := make(opt.ColList, len(aggs))
+	elems := make(memo.ScalarListExpr, len(aggs))
+	elemTypes := make([]*types.T, len(aggs))
+	for i := range aggs {
+		cols[i] = aggs[i].Col
+		elems[i] = count
+		elemTypes[i] = c.IntType()
+	}
+	return c.f.ConstructValues(
+		memo.ScalarListExpr{c.f.ConstructTuple(elems, types.MakeTuple(elemTypes))},
+		&memo.ValuesPrivate{Cols: cols, ID: c.mem.Metadata().NextUniqueID()},
+	)
+}
+
+// CanFoldAggsOverEmptyInput returns true if the result of every aggregate in
+// the given list is statically known when the aggregate is computed over an
+// empty input. See aggResultOverEmptyInput.
+func (c *CustomFuncs) CanFoldAggsOverEmptyInput(aggs memo.AggregationsExpr) bool {
+	for i := range aggs {
+		if c.aggResultOverEmptyInput(aggs[i].Agg) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// FoldAggsOverEmptyInput returns a single-row Values expression that contains
+// the result of each aggregate in the given list when it is computed over an
+// empty input. It should only be called if CanFoldAggsOverEmptyInput returns
+// true.
+func (c *CustomFuncs) FoldAggsOverEmptyInput(aggs memo.AggregationsExpr) memo.RelExpr {
+	cols := make(opt.ColList, len(aggs))
+	elems := make(memo.ScalarListExpr, len(aggs))
+	elemTypes := make([]*types.T, len(aggs))
+	for i := range aggs {
+		typ := aggs[i].Agg.DataType()
+		cols[i] = aggs[i].Col
+		elems[i] = c.f.ConstructConstVal(c.aggResultOverEmptyInput(aggs[i].Agg), typ)
+		elemTypes[i] = typ
+	}
+	return c.f.ConstructValues(
+		memo.ScalarListExpr{c.f.ConstructTuple(elems, types.MakeTuple(elemTypes))},
+		&memo.ValuesPrivate{Cols: cols, ID: c.mem.Metadata().NextUniqueID()},
+	)
+}
+
+// aggResultOverEmptyInput returns the result of the given aggregate when it is
+// computed over an empty input, or nil if the result is not known. Aggregate
+// filters and DISTINCT modifiers do not affect the result, since the input is
+// empty either way.
+func (c *CustomFuncs) aggResultOverEmptyInput(agg opt.ScalarExpr) tree.Datum {
+	switch memo.ExtractAggFunc(agg).Op() {
+	case opt.CountRowsOp, opt.CountOp:
+		return tree.DZero
+
+	case opt.MinOp, opt.MaxOp, opt.SumOp, opt.SumIntOp, opt.AvgOp, opt.BoolAndOp,
+		opt.BoolOrOp, opt.ArrayAggOp, opt.ConstAggOp, opt.ConstNotNullAggOp,
+		opt.AnyNotNullAggOp:
+		return tree.DNull
+	}
+	return nil
+}
+
+// maxFoldGroupByValuesRows is the maximum number of rows in a Values input for
+// which FoldGroupByValues computes the result of a GroupBy during
+// normalization.
+const maxFoldGroupByValuesRows = 100
+
+// FoldGroupByValues computes the result of a GroupBy over a constant Values
+// input, and returns it as a new Values operator with one row per group. The
+// columns of the new Values operator are the grouping columns, in increasing
+// order, followed by the aggregate columns. FoldGroupByValues returns ok=false
+// if the input has more than maxFoldGroupByValuesRows rows, if any of its
+// elements is not a constant value, or if any of the aggregates cannot be
+// folded (see canFoldAggOverRows).
+func (c *CustomFuncs) FoldGroupByValues(
+	values *memo.ValuesExpr, aggs memo.AggregationsExpr, private *memo.GroupingPrivate,
+) (_ memo.RelExpr, ok bool) {
+	if len(values.Rows) > maxFoldGroupByValuesRows {
+		return nil, false
+	}
+	for i := range aggs {
+		if !c.canFoldAggOverRows(aggs[i].Agg) {
+			return nil, false
+		}
+	}
+	rows, ok := c.extractValuesRows(values)
+	if !ok {
+		return nil, false
+	}
+
+	groupingCols := private.GroupingCols.ToList()
+	groupingOrds := make([]int, len(groupingCols))
+	for i, col := range groupingCols {
+		groupingOrds[i], _ = values.Cols.Find(col)
+	}
+
+	// Partition the rows into groups, in order of their first row. Rows are in
+	// the same group if the key encodings of their grouping columns are equal,
+	// which is also how GroupBy compares them during execution.
+	var groups [][]tree.Datums
+	var firstRows []int
+	groupIdx := make(map[string]int)
+	var encoded []byte
+	for i, row := range rows {
+		encoded = encoded[:0]
+		for _, ord := range groupingOrds {
+			var err error
+			encoded, err = rowenc.EncodeTableKey(encoded, row[ord], encoding.Ascending)
+			if err != nil {
+				return nil, false
+			}
+		}
+		idx, ok := groupIdx[string(encoded)]
+		if !ok {
+			idx = len(groups)
+			groupIdx[string(encoded)] = idx
+			groups = append(groups, nil)
+			firstRows = append(firstRows, i)
+		}
+		groups[idx] = append(groups[idx], row)
+	}
+
+	cols := make(opt.ColList, 0, len(groupingCols)+len(aggs))
+	cols = append(cols, groupingCols...)
+	for i := range aggs {
+		cols = append(cols, aggs[i].Col)
+	}
+
+	// Construct one row per group, taking the values of the grouping columns
+	// from the first row of the group.
+	newRows := make([]tree.Datums, len(groups))
+	for g, groupRows := range groups {
+		firstRow := rows[firstRows[g]]
+		newRow := make(tree.Datums, 0, len(cols))
+		for _, ord := range groupingOrds {
+			newRow = append(newRow, firstRow[ord])
+		}
+		for i := range aggs {
+			res, ok := c.foldAggOverRows(aggs[i].Agg, groupRows, values.Cols)
+			if !ok {
+				return nil, false
+			}
+			newRow = append(newRow, res)
+		}
+		newRows[g] = newRow
+	}
+
+	return c.f.ConstructValuesFromDatums(newRows, cols), true
+}
+
+// canFoldAggOverRows returns true if foldAggOverRows can compute the result of
+// the given aggregate. This is the case for COUNT(*), and for COUNT, SUM,
+// SUM_INT, MIN, and MAX of an input column. Aggregates with an AggDistinct or
+// AggFilter modifier are not supported.
+func (c *CustomFuncs) canFoldAggOverRows(agg opt.ScalarExpr) bool {
+	switch agg.Op() {
+	case opt.CountRowsOp:
+		return true
+
+	case opt.CountOp, opt.SumOp, opt.SumIntOp, opt.MinOp, opt.MaxOp:
+		return agg.Child(0).Op() == opt.VariableOp
+	}
+	return false
+}
+
+// foldAggOverRows computes the result of the given aggregate over the given
+// constant rows, whose columns are described by cols. The aggregate must be
+// supported by canFoldAggOverRows. foldAggOverRows returns ok=false if the
+// result cannot be computed, such as when SUM_INT overflows or SUM has an
+// input type other than INT or DECIMAL.
+func (c *CustomFuncs) foldAggOverRows(
+	agg opt.ScalarExpr, rows []tree.Datums, cols opt.ColList,
+) (_ tree.Datum, ok bool) {
+	if agg.Op() == opt.CountRowsOp {
+		return tree.NewDInt(tree.DInt(len(rows))), true
+	}
+	ord, ok := cols.Find(agg.Child(0).(*memo.VariableExpr).Col)
+	if !ok {
+		return nil, false
+	}
+
+	switch agg.Op() {
+	case opt.CountOp:
+		count := 0
+		for _, row := range rows {
+			if row[ord] != tree.DNull {
+				count++
+			}
+		}
+		return tree.NewDInt(tree.DInt(count)), true
+
+	case opt.MinOp, opt.MaxOp:
+		res := tree.Datum(tree.DNull)
+		for _, row := range rows {
+			d := row[ord]
+			if d == tree.DNull {
+				continue
+			}
+			if res == tree.DNull {
+				res = d
+				continue
+			}
+			cmp := d.Compare(c.f.evalCtx, res)
+			if (agg.Op() == opt.MinOp && cmp < 0) || (agg.Op() == opt.MaxOp && cmp > 0) {
+				res = d
+			}
+		}
+		return res, true
+
+	case opt.SumIntOp:
+		var sum int64
+		sawNonNull := false
+		for _, row := range rows {
+			d, isInt := row[ord].(*tree.DInt)
+			if !isInt {
+				if row[ord] == tree.DNull {
+					continue
+				}
+				return nil, false
+			}
+			if sum, ok = arith.AddWithOverflow(sum, int64(*d)); !ok {
+				return nil, false
+			}
+			sawNonNull = true
+		}
+		if !sawNonNull {
+			return tree.DNull, true
+		}
+		return tree.NewDInt(tree.DInt(sum)), true
+
+	case opt.SumOp:
+		var sum, scratch apd.Decimal
+		sawNonNull := false
+		for _, row := range rows {
+			var dec *apd.Decimal
+			switch t := row[ord].(type) {
+			case *tree.DInt:
+				scratch.SetInt64(int64(*t))
+				dec = &scratch
+			case *tree.DDecimal:
+				dec = &t.Decimal
+			default:
+				if row[ord] == tree.DNull {
+					continue
+				}
+				return nil, false
+			}
+			if _, err := tree.ExactCtx.Add(&sum, &sum, dec); err != nil {
+				return nil, false
+			}
+			sawNonNull = true
+		}
+		if !sawNonNull {
+			return tree.DNull, true
+		}
+		return &tree.DDecimal{Decimal: sum}, true
+	}
+	return nil, false
+}
+
+// CanProjectSingleRowAggs returns true if every aggregate in the given list
+// returns its (unmodified) input column when it is computed over a group that
+// contains exactly one row. An aggregate with an AggDistinct or AggFilter
+// modifier is not allowed.
+func (c *CustomFuncs) CanProjectSingleRowAggs(aggs memo.AggregationsExpr) bool {
+	for i := range aggs {
+		switch aggs[i].Agg.Op() {
+		case opt.ConstAggOp, opt.ConstNotNullAggOp, opt.AnyNotNullAggOp, opt.FirstAggOp,
+			opt.MinOp, opt.MaxOp, opt.BoolAndOp, opt.BoolOrOp:
+		default:
+			return false
+		}
+		if aggs[i].Agg.Child(0).Op() != opt.VariableOp {
+			return false
+		}
+	}
+	return true
+}
+
+// ProjectSingleRowAggs returns a Projections operator that maps the input
+// column of each aggregate in the given list to the aggregate's output column.
+// It should only be called if CanProjectSingleRowAggs returns true.
+func (c *CustomFuncs) ProjectSingleRowAggs(aggs memo.AggregationsExpr) memo.ProjectionsExpr {
+	projections := make(memo.ProjectionsExpr, len(aggs))
+	for i := range aggs {
+		projections[i] = c.f.ConstructProjectionsItem(memo.ExtractAggFirstVar(aggs[i].Agg), aggs[i].Col)
+	}
+	return projections
+}
+
 // HasNoGroupingCols returns true if the GroupingCols in the private are empty.
 func (c *CustomFuncs) HasNoGroupingCols(private *memo.GroupingPrivate) bool {
 	return private.GroupingCols.Empty()
@@ -139,6 +457,96 @@ func (c *CustomFuncs) ConstructProjectionFromDistinctOn(
 	return c.f.ConstructProject(input, projections, passthrough)
 }
 
+// CanPushDistinctBelowProject returns true if a DistinctOn with the given
+// aggregations and grouping private can be pushed below its input Project. This
+// is the case if:
+//
+//   1. The Project passes through all of the grouping columns.
+//   2. The ordering only references input columns of the Project, rather than
+//      columns that it synthesizes.
+//   3. None of the projections are volatile, since pushing the DistinctOn
+//      reduces the number of times they are evaluated.
+//   4. At least one non-constant synthesized column is aggregated, so that
+//      there is some projection work to save.
+//
+func (c *CustomFuncs) CanPushDistinctBelowProject(
+	project *memo.ProjectExpr, aggs memo.AggregationsExpr, private *memo.GroupingPrivate,
+) bool {
+	if !private.GroupingCols.SubsetOf(project.Passthrough) {
+		return false
+	}
+	if !private.Ordering.SubsetOfCols(project.Input.Relational().OutputCols) {
+		return false
+	}
+	for i := range project.Projections {
+		if project.Projections[i].ScalarProps().VolatilitySet.HasVolatile() {
+			return false
+		}
+	}
+	for i := range aggs {
+		col := memo.ExtractAggFirstVar(aggs[i].Agg).Col
+		for j := range project.Projections {
+			if item := &project.Projections[j]; item.Col == col {
+				if !opt.IsConstValueOp(item.Element) {
+					return true
+				}
+				break
+			}
+		}
+	}
+	return false
+}
+
+// PushDistinctBelowProject constructs a Project over a new DistinctOn over the
+// input of the given Project. Aggregations of passthrough columns are kept.
+// Aggregations of synthesized columns are replaced by FirstAgg aggregations of
+// the input columns that their projections reference, and the projections are
+// evaluated by the new Project instead, using the output columns of the
+// original aggregations. CanPushDistinctBelowProject must be true.
+func (c *CustomFuncs) PushDistinctBelowProject(
+	project *memo.ProjectExpr, aggs memo.AggregationsExpr, private *memo.GroupingPrivate,
+) memo.RelExpr {
+	inputCols := project.Input.Relational().OutputCols
+	synthesized := project.Projections.OutputCols()
+
+	// Grouping columns and the outputs of the kept aggregations are passed
+	// through by the new Project.
+	passthrough := private.GroupingCols.Copy()
+	newAggs := make(memo.AggregationsExpr, 0, len(aggs))
+	var projections memo.ProjectionsExpr
+	var neededCols opt.ColSet
+	for i := range aggs {
+		col := memo.ExtractAggFirstVar(aggs[i].Agg).Col
+		if !synthesized.Contains(col) {
+			newAggs = append(newAggs, aggs[i])
+			passthrough.Add(aggs[i].Col)
+			continue
+		}
+		for j := range project.Projections {
+			if item := &project.Projections[j]; item.Col == col {
+				projections = append(projections, c.f.ConstructProjectionsItem(item.Element, aggs[i].Col))
+				neededCols.UnionWith(item.ScalarProps().OuterCols.Intersection(inputCols))
+				break
+			}
+		}
+	}
+
+	// Add a FirstAgg for each input column that is referenced by the moved
+	// projections but is not already an output of the new DistinctOn.
+	neededCols.DifferenceWith(passthrough)
+	for col, ok := neededCols.Next(0); ok; col, ok = neededCols.Next(col + 1) {
+		newAggs = append(newAggs, c.f.ConstructAggregationsItem(
+			c.f.ConstructFirstAgg(c.f.ConstructVariable(col)), col,
+		))
+	}
+
+	return c.f.ConstructProject(
+		c.f.ConstructDistinctOn(project.Input, newAggs, private),
+		projections,
+		passthrough,
+	)
+}
+
 // AreValuesDistinct returns true if a constant Values operator input contains
 // only rows that are already distinct with respect to the given grouping
 // columns. The Values operator can be wrapped by Select, Project, LeftJoin
@@ -183,7 +591,7 @@ func (c *CustomFuncs) AreValuesDistinct(
 				eqCols.Add(rightColID)
 			}
 		}
-		if !t.Right.Relational().FuncDeps.ColsAreLaxKey(eqCols) {
+		if !c.ColsAreLaxKey(eqCols, t.Right) {
 			// Not joining on a right input key.
 			break
 		}
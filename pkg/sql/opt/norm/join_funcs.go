@@ -231,19 +231,9 @@ func (c *CustomFuncs) mapJoinOpEquivalenceGroup(
 		))
 	}
 
-	// Connect all the columns on the left.
-	for col, ok := leftEqCols.Next(firstLeftCol + 1); ok; col, ok = leftEqCols.Next(col + 1) {
-		newFilters = append(newFilters, c.f.ConstructFiltersItem(
-			c.f.ConstructEq(c.f.ConstructVariable(firstLeftCol), c.f.ConstructVariable(col)),
-		))
-	}
-
-	// Connect all the columns on the right.
-	for col, ok := rightEqCols.Next(firstRightCol + 1); ok; col, ok = rightEqCols.Next(col + 1) {
-		newFilters = append(newFilters, c.f.ConstructFiltersItem(
-			c.f.ConstructEq(c.f.ConstructVariable(firstRightCol), c.f.ConstructVariable(col)),
-		))
-	}
+	// Connect all the columns on the left, and all the columns on the right.
+	newFilters = c.appendEquivGroupFilters(newFilters, leftEqCols)
+	newFilters = c.appendEquivGroupFilters(newFilters, rightEqCols)
 
 	// Connect the two sides.
 	newFilters = append(newFilters, c.f.ConstructFiltersItem(
@@ -255,6 +245,87 @@ func (c *CustomFuncs) mapJoinOpEquivalenceGroup(
 	return newFilters
 }
 
+// CanInferJoinInputEqualities returns true if the equivalencies that hold in
+// the join filters and the join inputs imply an equality between two columns
+// on the same side of the join that is not implied by the filters and that
+// side's input alone. See InferJoinInputEqualities for details.
+func (c *CustomFuncs) CanInferJoinInputEqualities(
+	filters memo.FiltersExpr, left, right memo.RelExpr,
+) bool {
+	equivFD := c.GetEquivFD(filters, left, right)
+	return c.canInferJoinInputEqualities(filters, left, equivFD) ||
+		c.canInferJoinInputEqualities(filters, right, equivFD)
+}
+
+// canInferJoinInputEqualities returns true if some equivalence group in
+// equivFD contains columns of the given join input that are not equivalent
+// according to the filters and the input.
+func (c *CustomFuncs) canInferJoinInputEqualities(
+	filters memo.FiltersExpr, input memo.RelExpr, equivFD props.FuncDepSet,
+) bool {
+	knownFD := joinInputEquivFD(filters, input)
+	inputCols := input.Relational().OutputCols
+	equivReps := equivFD.EquivReps()
+	for col, ok := equivReps.Next(0); ok; col, ok = equivReps.Next(col + 1) {
+		eqCols := c.GetEquivColsWithEquivType(col, equivFD, false /* allowCompositeEncoding */)
+		eqCols.IntersectionWith(inputCols)
+		if first, ok := eqCols.Next(0); ok && !eqCols.SubsetOf(knownFD.ComputeEquivGroup(first)) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinInputEquivFD returns a FuncDepSet with the equivalence dependencies from
+// the given join filters and one of the join inputs.
+func joinInputEquivFD(filters memo.FiltersExpr, input memo.RelExpr) (equivFD props.FuncDepSet) {
+	for i := range filters {
+		equivFD.AddEquivFrom(&filters[i].ScalarProps().FuncDeps)
+	}
+	equivFD.AddEquivFrom(&input.Relational().FuncDeps)
+	return equivFD
+}
+
+// InferJoinInputEqualities returns the given join filters with additional
+// equality conditions between columns on the same side of the join. The
+// conditions are implied by the equivalencies that hold in the filters and the
+// join inputs, but not by the filters and that side's input alone. For example,
+// if a.x = a.y holds in the left input, then the filters:
+//
+//   a.x = b.x AND a.y = b.y
+//
+// would be converted to:
+//
+//   a.x = b.x AND a.y = b.y AND b.x = b.y
+//
+// Only the equalities needed to connect each equivalence group are added, and
+// the existing filters are kept as they are.
+func (c *CustomFuncs) InferJoinInputEqualities(
+	filters memo.FiltersExpr, left, right memo.RelExpr,
+) memo.FiltersExpr {
+	equivFD := c.GetEquivFD(filters, left, right)
+	newFilters := make(memo.FiltersExpr, len(filters), len(filters)+1)
+	copy(newFilters, filters)
+	newFilters = c.inferJoinInputEqualities(newFilters, filters, left, equivFD)
+	return c.inferJoinInputEqualities(newFilters, filters, right, equivFD)
+}
+
+// inferJoinInputEqualities appends to newFilters the equalities between columns
+// of the given join input that are implied by equivFD, but not by the filters
+// and the input.
+func (c *CustomFuncs) inferJoinInputEqualities(
+	newFilters, filters memo.FiltersExpr, input memo.RelExpr, equivFD props.FuncDepSet,
+) memo.FiltersExpr {
+	knownFD := joinInputEquivFD(filters, input)
+	inputCols := input.Relational().OutputCols
+	equivFD.EquivReps().ForEach(func(col opt.ColumnID) {
+		eqCols := c.GetEquivColsWithEquivType(col, equivFD, false /* allowCompositeEncoding */)
+		eqCols.IntersectionWith(inputCols)
+		newFilters = c.appendUnimpliedEquivFilters(newFilters, eqCols, &knownFD)
+	})
+	return newFilters
+}
+
 // CanMapJoinOpFilter returns true if it is possible to map a boolean expression
 // src, which is a conjunct in the given filters expression, to use the output
 // columns of the relational expression dst.
@@ -10,26 +10,54 @@
 
 package norm
 
-import "github.com/cockroachdb/cockroach/pkg/sql/opt/memo"
+import (
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/memo"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+)
 
-// listSorter is a helper struct that implements the sort.Slice "less"
-// comparison function.
+// listSorter is a helper struct that implements sort.Interface for a list of
+// constant values or tuples or arrays of constant values. The datum for each
+// item is extracted once up front and kept in a parallel slice, so that
+// comparisons during the sort do not need to extract them again.
 type listSorter struct {
-	cf   *CustomFuncs
-	list memo.ScalarListExpr
+	cf     *CustomFuncs
+	list   memo.ScalarListExpr
+	datums tree.Datums
 }
 
-// less returns true if item i in the list compares less than item j.
-// sort.Slice uses this method to sort the list.
-func (s listSorter) less(i, j int) bool {
+// makeListSorter returns a listSorter for the given list, which must be
+// composed entirely of constant values or tuples or arrays of constant values
+// (see memo.CanExtractConstDatum). Sorting the listSorter reorders the list in
+// place.
+func makeListSorter(cf *CustomFuncs, list memo.ScalarListExpr) listSorter {
+	datums := make(tree.Datums, len(list))
+	for i := range list {
+		datums[i] = memo.ExtractConstDatum(list[i])
+	}
+	return listSorter{cf: cf, list: list, datums: datums}
+}
+
+// Len is part of the sort.Interface implementation.
+func (s listSorter) Len() int {
+	return len(s.list)
+}
+
+// Less returns true if item i in the list compares less than item j. It is
+// part of the sort.Interface implementation.
+func (s listSorter) Less(i, j int) bool {
 	return s.compare(i, j) < 0
 }
 
+// Swap is part of the sort.Interface implementation.
+func (s listSorter) Swap(i, j int) {
+	s.list[i], s.list[j] = s.list[j], s.list[i]
+	s.datums[i], s.datums[j] = s.datums[j], s.datums[i]
+}
+
 // compare returns -1 if item i compares less than item j, 0 if they are equal,
 // and 1 if item i compares greater. Constants are sorted according to Datum
-// comparison rules.
+// comparison rules. Tuples of constants are extracted as DTuples, so they are
+// compared element-wise, from left to right.
 func (s listSorter) compare(i, j int) int {
-	leftD := memo.ExtractConstDatum(s.list[i])
-	rightD := memo.ExtractConstDatum(s.list[j])
-	return leftD.Compare(s.cf.f.evalCtx, rightD)
+	return s.datums[i].Compare(s.cf.f.evalCtx, s.datums[j])
 }
@@ -0,0 +1,89 @@
+// Copyright 2021 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package norm
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/memo"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/sql/types"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+// makeConstIntList returns a list of n integer constants in random order,
+// drawn from [0, n/2) so that the list contains duplicates.
+func makeConstIntList(f *Factory, rng *rand.Rand, n int) memo.ScalarListExpr {
+	list := make(memo.ScalarListExpr, n)
+	for i := range list {
+		list[i] = f.ConstructConstVal(tree.NewDInt(tree.DInt(rng.Intn(n/2+1))), types.Int)
+	}
+	return list
+}
+
+func TestConstructSortedUniqueList(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+	var f Factory
+	f.Init(&evalCtx, nil /* catalog */)
+	c := f.CustomFuncs()
+
+	rng := rand.New(rand.NewSource(0))
+	list := makeConstIntList(&f, rng, 100)
+	orig := append(memo.ScalarListExpr(nil), list...)
+
+	if !c.NeedSortedUniqueList(list) {
+		t.Fatal("expected random list to need sorting")
+	}
+	sorted, typ := c.ConstructSortedUniqueList(list)
+	if len(typ.TupleContents()) != len(sorted) {
+		t.Fatalf("expected %d tuple contents, got %d", len(sorted), len(typ.TupleContents()))
+	}
+	for i := 1; i < len(sorted); i++ {
+		left := memo.ExtractConstDatum(sorted[i-1])
+		right := memo.ExtractConstDatum(sorted[i])
+		if left.Compare(&evalCtx, right) >= 0 {
+			t.Fatalf("expected sorted unique list, got %s before %s", left, right)
+		}
+	}
+	if c.NeedSortedUniqueList(sorted) {
+		t.Fatal("expected sorted list to not need sorting")
+	}
+
+	// The input list must not be modified.
+	for i := range list {
+		if list[i] != orig[i] {
+			t.Fatalf("input list was modified at index %d", i)
+		}
+	}
+}
+
+func BenchmarkConstructSortedUniqueList(b *testing.B) {
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+	var f Factory
+	f.Init(&evalCtx, nil /* catalog */)
+	c := f.CustomFuncs()
+
+	rng := rand.New(rand.NewSource(0))
+	for _, n := range []int{10, 100, 1000, 10000} {
+		list := makeConstIntList(&f, rng, n)
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				c.ConstructSortedUniqueList(list)
+			}
+		})
+	}
+}
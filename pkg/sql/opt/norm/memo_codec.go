@@ -0,0 +1,865 @@
+// Copyright 2021 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package norm
+
+import (
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/cat"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/memo"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/props"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/props/physical"
+	"github.com/cockroachdb/cockroach/pkg/sql/privilege"
+	"github.com/cockroachdb/cockroach/pkg/sql/rowenc"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/sql/types"
+	"github.com/cockroachdb/cockroach/pkg/util/encoding"
+	"github.com/cockroachdb/cockroach/pkg/util/errorutil"
+	"github.com/cockroachdb/errors"
+)
+
+// memoEncodingVersion is written at the start of every encoded memo. It must be
+// incremented whenever the encoding changes in an incompatible way.
+const memoEncodingVersion = 1
+
+// Metadata entry kinds. The metadata is encoded as a list of entries in column
+// ID order, so that replaying the entries reproduces the same table and column
+// IDs.
+const (
+	// tableMetaEntry adds a table, along with all of its columns.
+	tableMetaEntry = iota + 1
+
+	// columnMetaEntry adds a single column that does not belong to a table.
+	columnMetaEntry
+)
+
+// EncodeMemo returns a compact binary encoding of the given normalized memo,
+// which can be loaded into a factory by InjectMemo, possibly in another
+// process. The encoding has three parts:
+//
+//   1. A version number.
+//   2. The metadata, as a list of tables and columns in column ID order. Tables
+//      are referenced by their StableID, so they must be resolvable by the
+//      catalog of the factory that loads the memo.
+//   3. The expressions, as a list of nodes terminated by UnknownOp. A
+//      normalized memo has a single expression per group, so each node
+//      corresponds to a group. Children precede their parents and are
+//      referenced by their position in the list, and the root expression is
+//      the last node, followed by its required physical properties. Interned
+//      lists are encoded inline with the node that owns them, and privates are
+//      prefixed by a tag that identifies their codec in privateCodecs.
+//
+// Only metadata needed to reconstruct the expressions is encoded. The table
+// metadata that optbuilder derives from the schema, such as partial index
+// predicates, check constraints and computed column expressions, cannot be
+// rebuilt when the memo is loaded, so memos that reference tables with such
+// metadata cannot be encoded or loaded. Memos that depend on views or
+// user-defined types cannot be encoded either, since those dependencies would
+// be lost. An error is returned if the memo contains an operator or private
+// type that cannot be encoded.
+func EncodeMemo(m *memo.Memo) (_ []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			// This code allows us to propagate errors without adding lots of checks
+			// for `if err != nil` throughout the encoding code. This is only
+			// possible because the code does not update shared state and does not
+			// manipulate locks.
+			if ok, e := errorutil.ShouldCatch(r); ok {
+				err = e
+			} else {
+				panic(r)
+			}
+		}
+	}()
+
+	if m.IsOptimized() {
+		return nil, errors.AssertionFailedf("cannot encode an optimized memo")
+	}
+
+	e := memoEncoder{nodes: make(map[opt.Expr]uint64)}
+	e.writeUvarint(memoEncodingVersion)
+	e.writeMetadata(m.Metadata())
+	e.writeExpr(m.RootExpr())
+	e.writeUvarint(uint64(opt.UnknownOp))
+	e.writePhysicalProps(m.RootProps())
+	return e.buf, nil
+}
+
+// InjectMemo builds this factory's memo from an encoding produced by
+// EncodeMemo. The factory's memo must be empty. Tables are resolved by
+// StableID using the factory's catalog, and require the SELECT privilege. Each
+// table is recorded as a dependency of the memo's metadata, so that the loaded
+// memo becomes stale if the table or its privileges change. Normalization rules
+// are disabled while the expressions are constructed, so that the loaded memo
+// has the same expressions as the memo that was encoded.
+func (f *Factory) InjectMemo(data []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			// This code allows us to propagate errors without adding lots of checks
+			// for `if err != nil` throughout the decoding code. This is only
+			// possible because the code does not update shared state and does not
+			// manipulate locks.
+			if ok, e := errorutil.ShouldCatch(r); ok {
+				err = e
+			} else {
+				panic(r)
+			}
+		}
+	}()
+
+	if !f.mem.IsEmpty() {
+		return errors.AssertionFailedf("destination memo must be empty")
+	}
+	if f.catalog == nil {
+		return errors.AssertionFailedf("a catalog is required to load a memo")
+	}
+
+	matchedRule := f.userMatchedRule
+	f.DisableOptimizations()
+	defer f.NotifyOnMatchedRule(matchedRule)
+
+	d := memoDecoder{f: f, buf: data}
+	if version := d.readUvarint(); version != memoEncodingVersion {
+		return errors.Newf("unsupported memo encoding version %d", version)
+	}
+	d.readMetadata()
+	d.readExprs()
+	root, ok := d.nodes[len(d.nodes)-1].(memo.RelExpr)
+	if !ok {
+		return errors.Newf("encoded memo root is not a relational expression")
+	}
+	rootProps := d.readPhysicalProps()
+	if len(d.buf) != 0 {
+		return errors.Newf("encoded memo has %d trailing bytes", len(d.buf))
+	}
+	f.mem.SetRoot(root, rootProps)
+	return nil
+}
+
+// privateTag identifies the codec used to encode a private in privateCodecs.
+type privateTag uint64
+
+const (
+	noPrivate privateTag = iota
+	columnIDPrivate
+	colSetPrivate
+	typePrivate
+	operatorPrivate
+	tupleOrdinalPrivate
+	stringPrivate
+	orderingPrivate
+	scanPrivate
+	joinPrivate
+	groupingPrivate
+	setPrivate
+	valuesPrivate
+	numPrivateTags
+)
+
+// privateCodec encodes and decodes a private of a single type. The decoded
+// value must have the same dynamic type as the value returned by the Private
+// method of the expression, so that it can be passed to DynamicConstruct.
+type privateCodec struct {
+	encode func(e *memoEncoder, private interface{})
+	decode func(d *memoDecoder) interface{}
+}
+
+// privateTagOf returns the tag of the codec that encodes the given private.
+// It returns ok=false if the private cannot be encoded.
+func privateTagOf(private interface{}) (_ privateTag, ok bool) {
+	switch private.(type) {
+	case nil:
+		return noPrivate, true
+	case *opt.ColumnID:
+		return columnIDPrivate, true
+	case *opt.ColSet:
+		return colSetPrivate, true
+	case *types.T:
+		return typePrivate, true
+	case *opt.Operator:
+		return operatorPrivate, true
+	case *memo.TupleOrdinal:
+		return tupleOrdinalPrivate, true
+	case *string:
+		return stringPrivate, true
+	case *props.OrderingChoice:
+		return orderingPrivate, true
+	case *memo.ScanPrivate:
+		return scanPrivate, true
+	case *memo.JoinPrivate:
+		return joinPrivate, true
+	case *memo.GroupingPrivate:
+		return groupingPrivate, true
+	case *memo.SetPrivate:
+		return setPrivate, true
+	case *memo.ValuesPrivate:
+		return valuesPrivate, true
+	}
+	return 0, false
+}
+
+// privateCodecs is the registry of private codecs, indexed by privateTag.
+var privateCodecs = [numPrivateTags]privateCodec{
+	noPrivate: {
+		encode: func(e *memoEncoder, private interface{}) {},
+		decode: func(d *memoDecoder) interface{} { return nil },
+	},
+	columnIDPrivate: {
+		encode: func(e *memoEncoder, private interface{}) {
+			e.writeUvarint(uint64(*private.(*opt.ColumnID)))
+		},
+		decode: func(d *memoDecoder) interface{} {
+			col := opt.ColumnID(d.readUvarint())
+			return &col
+		},
+	},
+	colSetPrivate: {
+		encode: func(e *memoEncoder, private interface{}) {
+			e.writeColSet(*private.(*opt.ColSet))
+		},
+		decode: func(d *memoDecoder) interface{} {
+			cols := d.readColSet()
+			return &cols
+		},
+	},
+	typePrivate: {
+		encode: func(e *memoEncoder, private interface{}) {
+			e.writeType(private.(*types.T))
+		},
+		decode: func(d *memoDecoder) interface{} {
+			return d.readType()
+		},
+	},
+	operatorPrivate: {
+		encode: func(e *memoEncoder, private interface{}) {
+			e.writeUvarint(uint64(*private.(*opt.Operator)))
+		},
+		decode: func(d *memoDecoder) interface{} {
+			op := d.readOperator()
+			return &op
+		},
+	},
+	tupleOrdinalPrivate: {
+		encode: func(e *memoEncoder, private interface{}) {
+			e.writeUvarint(uint64(*private.(*memo.TupleOrdinal)))
+		},
+		decode: func(d *memoDecoder) interface{} {
+			idx := memo.TupleOrdinal(d.readUvarint())
+			return &idx
+		},
+	},
+	stringPrivate: {
+		encode: func(e *memoEncoder, private interface{}) {
+			e.writeString(*private.(*string))
+		},
+		decode: func(d *memoDecoder) interface{} {
+			s := d.readString()
+			return &s
+		},
+	},
+	orderingPrivate: {
+		encode: func(e *memoEncoder, private interface{}) {
+			e.writeOrdering(private.(*props.OrderingChoice))
+		},
+		decode: func(d *memoDecoder) interface{} {
+			ordering := d.readOrdering()
+			return &ordering
+		},
+	},
+	scanPrivate: {
+		encode: func(e *memoEncoder, private interface{}) {
+			p := private.(*memo.ScanPrivate)
+			if p.Constraint != nil || p.InvertedConstraint != nil || p.HardLimit != 0 ||
+				!p.Flags.Empty() || p.Locking != nil || p.LocalityOptimized ||
+				p.PartitionConstrainedScan || p.ExactPrefix != 0 {
+				panic(errors.Newf("cannot encode a constrained, limited, hinted or locking scan"))
+			}
+			e.writeUvarint(uint64(p.Table))
+			e.writeUvarint(uint64(p.Index))
+			e.writeColSet(p.Cols)
+		},
+		decode: func(d *memoDecoder) interface{} {
+			return &memo.ScanPrivate{
+				Table: opt.TableID(d.readUvarint()),
+				Index: cat.IndexOrdinal(d.readUvarint()),
+				Cols:  d.readColSet(),
+			}
+		},
+	},
+	joinPrivate: {
+		encode: func(e *memoEncoder, private interface{}) {
+			p := private.(*memo.JoinPrivate)
+			e.writeUvarint(uint64(p.Flags))
+			e.writeBool(p.SkipReorderJoins)
+		},
+		decode: func(d *memoDecoder) interface{} {
+			return &memo.JoinPrivate{
+				Flags:            memo.JoinFlags(d.readUvarint()),
+				SkipReorderJoins: d.readBool(),
+			}
+		},
+	},
+	groupingPrivate: {
+		encode: func(e *memoEncoder, private interface{}) {
+			p := private.(*memo.GroupingPrivate)
+			e.writeColSet(p.GroupingCols)
+			e.writeOrdering(&p.Ordering)
+			e.writeBool(p.NullsAreDistinct)
+			e.writeString(p.ErrorOnDup)
+		},
+		decode: func(d *memoDecoder) interface{} {
+			return &memo.GroupingPrivate{
+				GroupingCols:     d.readColSet(),
+				Ordering:         d.readOrdering(),
+				NullsAreDistinct: d.readBool(),
+				ErrorOnDup:       d.readString(),
+			}
+		},
+	},
+	setPrivate: {
+		encode: func(e *memoEncoder, private interface{}) {
+			p := private.(*memo.SetPrivate)
+			e.writeColList(p.LeftCols)
+			e.writeColList(p.RightCols)
+			e.writeColList(p.OutCols)
+		},
+		decode: func(d *memoDecoder) interface{} {
+			return &memo.SetPrivate{
+				LeftCols:  d.readColList(),
+				RightCols: d.readColList(),
+				OutCols:   d.readColList(),
+			}
+		},
+	},
+	valuesPrivate: {
+		encode: func(e *memoEncoder, private interface{}) {
+			e.writeColList(private.(*memo.ValuesPrivate).Cols)
+		},
+		decode: func(d *memoDecoder) interface{} {
+			return &memo.ValuesPrivate{
+				Cols: d.readColList(),
+				ID:   d.f.Metadata().NextUniqueID(),
+			}
+		},
+	},
+}
+
+// memoEncoder encodes a memo. See EncodeMemo for a description of the format.
+// Errors are propagated by panicking.
+type memoEncoder struct {
+	buf []byte
+
+	// nodes maps each expression that has been encoded to its position in the
+	// list of nodes.
+	nodes map[opt.Expr]uint64
+}
+
+func (e *memoEncoder) writeMetadata(md *opt.Metadata) {
+	if len(md.AllViews()) > 0 {
+		panic(errors.Newf("cannot encode a memo that depends on views"))
+	}
+	if len(md.AllUserDefinedTypes()) > 0 {
+		panic(errors.Newf("cannot encode a memo that depends on user-defined types"))
+	}
+	for col, n := opt.ColumnID(1), opt.ColumnID(md.NumColumns()); col <= n; {
+		colMeta := md.ColumnMeta(col)
+		if colMeta.Table == 0 {
+			e.writeUvarint(columnMetaEntry)
+			e.writeString(colMeta.Alias)
+			e.writeType(colMeta.Type)
+			col++
+			continue
+		}
+
+		tabMeta := md.TableMeta(colMeta.Table)
+		if colMeta.Table.ColumnID(0) != col {
+			panic(errors.AssertionFailedf("column %d is not the first column of its table", col))
+		}
+		if err := checkTableCanBeLoaded(tabMeta.Table); err != nil {
+			panic(err)
+		}
+		e.writeUvarint(tableMetaEntry)
+		e.writeUvarint(uint64(tabMeta.Table.ID()))
+		e.writeUvarint(uint64(tabMeta.Table.ColumnCount()))
+		e.writeString(string(tabMeta.Alias.CatalogName))
+		e.writeString(string(tabMeta.Alias.SchemaName))
+		e.writeString(string(tabMeta.Alias.ObjectName))
+		e.writeBool(tabMeta.Alias.ExplicitCatalog)
+		e.writeBool(tabMeta.Alias.ExplicitSchema)
+		col += opt.ColumnID(tabMeta.Table.ColumnCount())
+	}
+	e.writeUvarint(0)
+}
+
+// checkTableCanBeLoaded returns an error if the given table has partial
+// indexes, check constraints or computed columns. optbuilder adds the
+// corresponding expressions to the table metadata when it builds a query, but
+// they cannot be rebuilt when a memo is loaded, and exploration relies on them
+// (for example, to scan a partial index).
+func checkTableCanBeLoaded(tab cat.Table) error {
+	for i, n := 0, tab.DeletableIndexCount(); i < n; i++ {
+		if _, isPartial := tab.Index(i).Predicate(); isPartial {
+			return errors.Newf("table %s has a partial index, which encoded memos do not support", tab.Name())
+		}
+	}
+	if tab.CheckCount() > 0 {
+		return errors.Newf("table %s has check constraints, which encoded memos do not support", tab.Name())
+	}
+	for i, n := 0, tab.ColumnCount(); i < n; i++ {
+		if tab.Column(i).IsComputed() {
+			return errors.Newf("table %s has computed columns, which encoded memos do not support", tab.Name())
+		}
+	}
+	return nil
+}
+
+// writeExpr encodes the given expression, after first encoding its children,
+// and returns its position in the list of nodes. Expressions that have already
+// been encoded are not encoded again.
+func (e *memoEncoder) writeExpr(expr opt.Expr) uint64 {
+	if ref, ok := e.nodes[expr]; ok {
+		return ref
+	}
+
+	switch t := expr.(type) {
+	case *memo.ConstExpr:
+		e.writeUvarint(uint64(opt.ConstOp))
+		e.writeType(t.Typ)
+		e.writeDatum(t.Value)
+
+	case *memo.FiltersExpr:
+		refs := make([]uint64, len(*t))
+		for i := range *t {
+			refs[i] = e.writeExpr((*t)[i].Condition)
+		}
+		e.writeUvarint(uint64(opt.FiltersOp))
+		e.writeRefs(refs)
+
+	case *memo.ProjectionsExpr:
+		refs := make([]uint64, len(*t))
+		for i := range *t {
+			refs[i] = e.writeExpr((*t)[i].Element)
+		}
+		e.writeUvarint(uint64(opt.ProjectionsOp))
+		e.writeRefs(refs)
+		for i := range *t {
+			e.writeUvarint(uint64((*t)[i].Col))
+		}
+
+	case *memo.AggregationsExpr:
+		refs := make([]uint64, len(*t))
+		for i := range *t {
+			refs[i] = e.writeExpr((*t)[i].Agg)
+		}
+		e.writeUvarint(uint64(opt.AggregationsOp))
+		e.writeRefs(refs)
+		for i := range *t {
+			e.writeUvarint(uint64((*t)[i].Col))
+		}
+
+	case *memo.ScalarListExpr:
+		refs := make([]uint64, len(*t))
+		for i := range *t {
+			refs[i] = e.writeExpr((*t)[i])
+		}
+		e.writeUvarint(uint64(opt.ScalarListOp))
+		e.writeRefs(refs)
+
+	default:
+		if opt.IsListOp(expr) || opt.IsListItemOp(expr) {
+			panic(errors.Newf("cannot encode operator %s", expr.Op()))
+		}
+		tag, ok := privateTagOf(expr.Private())
+		if !ok {
+			panic(errors.Newf("cannot encode private of type %T", expr.Private()))
+		}
+		refs := make([]uint64, expr.ChildCount())
+		for i := range refs {
+			refs[i] = e.writeExpr(expr.Child(i))
+		}
+		e.writeUvarint(uint64(expr.Op()))
+		e.writeRefs(refs)
+		e.writeUvarint(uint64(tag))
+		privateCodecs[tag].encode(e, expr.Private())
+	}
+
+	ref := uint64(len(e.nodes))
+	e.nodes[expr] = ref
+	return ref
+}
+
+func (e *memoEncoder) writePhysicalProps(required *physical.Required) {
+	e.writeBool(!required.Presentation.Any())
+	e.writeUvarint(uint64(len(required.Presentation)))
+	for _, col := range required.Presentation {
+		e.writeString(col.Alias)
+		e.writeUvarint(uint64(col.ID))
+	}
+	e.writeOrdering(&required.Ordering)
+	e.buf = encoding.EncodeFloatAscending(e.buf, required.LimitHint)
+}
+
+func (e *memoEncoder) writeRefs(refs []uint64) {
+	e.writeUvarint(uint64(len(refs)))
+	for _, ref := range refs {
+		e.writeUvarint(ref)
+	}
+}
+
+func (e *memoEncoder) writeUvarint(v uint64) {
+	e.buf = encoding.EncodeUvarintAscending(e.buf, v)
+}
+
+func (e *memoEncoder) writeBool(b bool) {
+	if b {
+		e.writeUvarint(1)
+	} else {
+		e.writeUvarint(0)
+	}
+}
+
+func (e *memoEncoder) writeString(s string) {
+	e.buf = encoding.EncodeStringAscending(e.buf, s)
+}
+
+func (e *memoEncoder) writeColSet(cols opt.ColSet) {
+	e.writeUvarint(uint64(cols.Len()))
+	for col, ok := cols.Next(0); ok; col, ok = cols.Next(col + 1) {
+		e.writeUvarint(uint64(col))
+	}
+}
+
+func (e *memoEncoder) writeColList(cols opt.ColList) {
+	e.writeUvarint(uint64(len(cols)))
+	for _, col := range cols {
+		e.writeUvarint(uint64(col))
+	}
+}
+
+func (e *memoEncoder) writeOrdering(ordering *props.OrderingChoice) {
+	e.writeColSet(ordering.Optional)
+	e.writeUvarint(uint64(len(ordering.Columns)))
+	for i := range ordering.Columns {
+		e.writeColSet(ordering.Columns[i].Group)
+		e.writeBool(ordering.Columns[i].Descending)
+	}
+}
+
+func (e *memoEncoder) writeType(typ *types.T) {
+	data, err := typ.Marshal()
+	if err != nil {
+		panic(err)
+	}
+	e.buf = encoding.EncodeBytesAscending(e.buf, data)
+}
+
+// writeDatum encodes the given datum using the table value encoding. The type
+// of the datum is not encoded, and must be known when it is decoded.
+func (e *memoEncoder) writeDatum(d tree.Datum) {
+	data, err := rowenc.EncodeTableValue(
+		nil /* appendTo */, descpb.ColumnID(encoding.NoColumnID), d, nil, /* scratch */
+	)
+	if err != nil {
+		panic(err)
+	}
+	e.buf = encoding.EncodeBytesAscending(e.buf, data)
+}
+
+// memoDecoder decodes a memo into a factory. See EncodeMemo for a description
+// of the format. Errors are propagated by panicking.
+type memoDecoder struct {
+	f   *Factory
+	buf []byte
+
+	// nodes contains the decoded expressions, in the order they were encoded.
+	nodes []opt.Expr
+
+	alloc rowenc.DatumAlloc
+}
+
+func (d *memoDecoder) readMetadata() {
+	md := d.f.Metadata()
+	for {
+		switch kind := d.readUvarint(); kind {
+		case 0:
+			return
+
+		case columnMetaEntry:
+			alias := d.readString()
+			md.AddColumn(alias, d.readType())
+
+		case tableMetaEntry:
+			id := cat.StableID(d.readUvarint())
+			numCols := int(d.readUvarint())
+			var alias tree.TableName
+			alias.CatalogName = tree.Name(d.readString())
+			alias.SchemaName = tree.Name(d.readString())
+			alias.ObjectName = tree.Name(d.readString())
+			alias.ExplicitCatalog = d.readBool()
+			alias.ExplicitSchema = d.readBool()
+
+			ds, _, err := d.f.catalog.ResolveDataSourceByID(d.f.evalCtx.Context, cat.Flags{}, id)
+			if err != nil {
+				panic(err)
+			}
+			tab, ok := ds.(cat.Table)
+			if !ok {
+				panic(errors.Newf("data source %d is not a table", id))
+			}
+			if err := checkTableCanBeLoaded(tab); err != nil {
+				panic(err)
+			}
+			if tab.ColumnCount() != numCols {
+				panic(errors.Newf(
+					"table %s has %d columns, but the encoded memo expects %d",
+					tab.Name(), tab.ColumnCount(), numCols,
+				))
+			}
+			// Check that the user can access the table, and record it as a
+			// dependency, as optbuilder does when it resolves a table. This
+			// allows Memo.IsStale to detect schema and privilege changes.
+			depName := opt.DepByID(id)
+			if err := d.f.catalog.CheckPrivilege(d.f.evalCtx.Context, ds, privilege.SELECT); err != nil {
+				panic(err)
+			}
+			md.AddDependency(depName, ds, privilege.SELECT)
+			md.AddTable(tab, &alias)
+
+		default:
+			panic(errors.Newf("unknown metadata entry kind %d", kind))
+		}
+	}
+}
+
+// readExprs decodes the list of nodes, constructing each expression in the
+// factory's memo.
+func (d *memoDecoder) readExprs() {
+	for {
+		op := d.readOperator()
+		if op == opt.UnknownOp {
+			break
+		}
+
+		var expr opt.Expr
+		switch op {
+		case opt.ConstOp:
+			typ := d.readType()
+			expr = d.f.ConstructConstVal(d.readDatum(typ), typ)
+
+		case opt.FiltersOp:
+			refs := d.readRefs()
+			filters := make(memo.FiltersExpr, len(refs))
+			for i := range refs {
+				filters[i] = d.f.ConstructFiltersItem(d.scalarNode(refs[i]))
+			}
+			expr = &filters
+
+		case opt.ProjectionsOp:
+			refs := d.readRefs()
+			projections := make(memo.ProjectionsExpr, len(refs))
+			for i := range refs {
+				projections[i] = d.f.ConstructProjectionsItem(
+					d.scalarNode(refs[i]), opt.ColumnID(d.readUvarint()),
+				)
+			}
+			expr = &projections
+
+		case opt.AggregationsOp:
+			refs := d.readRefs()
+			aggs := make(memo.AggregationsExpr, len(refs))
+			for i := range refs {
+				aggs[i] = d.f.ConstructAggregationsItem(
+					d.scalarNode(refs[i]), opt.ColumnID(d.readUvarint()),
+				)
+			}
+			expr = &aggs
+
+		case opt.ScalarListOp:
+			refs := d.readRefs()
+			list := make(memo.ScalarListExpr, len(refs))
+			for i := range refs {
+				list[i] = d.scalarNode(refs[i])
+			}
+			expr = &list
+
+		default:
+			refs := d.readRefs()
+			tag := privateTag(d.readUvarint())
+			if tag >= numPrivateTags {
+				panic(errors.Newf("unknown private tag %d", tag))
+			}
+			args := make([]interface{}, len(refs), len(refs)+1)
+			for i := range refs {
+				args[i] = d.node(refs[i])
+			}
+			if tag != noPrivate {
+				args = append(args, privateCodecs[tag].decode(d))
+			}
+			expr = d.f.DynamicConstruct(op, args...)
+		}
+		d.nodes = append(d.nodes, expr)
+	}
+
+	if len(d.nodes) == 0 {
+		panic(errors.Newf("encoded memo has no expressions"))
+	}
+}
+
+func (d *memoDecoder) readPhysicalProps() *physical.Required {
+	var required physical.Required
+	if d.readBool() {
+		required.Presentation = make(physical.Presentation, d.readLength())
+		for i := range required.Presentation {
+			required.Presentation[i].Alias = d.readString()
+			required.Presentation[i].ID = opt.ColumnID(d.readUvarint())
+		}
+	} else if d.readUvarint() != 0 {
+		panic(errors.Newf("unexpected presentation columns"))
+	}
+	required.Ordering = d.readOrdering()
+
+	var err error
+	d.buf, required.LimitHint, err = encoding.DecodeFloatAscending(d.buf)
+	if err != nil {
+		panic(err)
+	}
+	return &required
+}
+
+// node returns the previously decoded expression at the given position.
+func (d *memoDecoder) node(ref uint64) opt.Expr {
+	if ref >= uint64(len(d.nodes)) {
+		panic(errors.Newf("invalid expression reference %d", ref))
+	}
+	return d.nodes[ref]
+}
+
+// scalarNode is similar to node, but requires the expression to be a scalar
+// expression.
+func (d *memoDecoder) scalarNode(ref uint64) opt.ScalarExpr {
+	scalar, ok := d.node(ref).(opt.ScalarExpr)
+	if !ok {
+		panic(errors.Newf("expression reference %d is not a scalar expression", ref))
+	}
+	return scalar
+}
+
+func (d *memoDecoder) readRefs() []uint64 {
+	refs := make([]uint64, d.readLength())
+	for i := range refs {
+		refs[i] = d.readUvarint()
+	}
+	return refs
+}
+
+func (d *memoDecoder) readUvarint() uint64 {
+	var v uint64
+	var err error
+	d.buf, v, err = encoding.DecodeUvarintAscending(d.buf)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// readLength reads the length of a list. Each list element is encoded using at
+// least one byte, so a length that exceeds the number of remaining bytes means
+// that the encoding is corrupt. Checking this before the list is allocated
+// prevents a corrupt encoding from requesting a huge allocation.
+func (d *memoDecoder) readLength() int {
+	n := d.readUvarint()
+	if n > uint64(len(d.buf)) {
+		panic(errors.Newf("invalid list length %d with %d bytes remaining", n, len(d.buf)))
+	}
+	return int(n)
+}
+
+func (d *memoDecoder) readOperator() opt.Operator {
+	op := d.readUvarint()
+	if op >= uint64(opt.NumOperators) {
+		panic(errors.Newf("unknown operator %d", op))
+	}
+	return opt.Operator(op)
+}
+
+func (d *memoDecoder) readBool() bool {
+	return d.readUvarint() != 0
+}
+
+func (d *memoDecoder) readString() string {
+	var s []byte
+	var err error
+	d.buf, s, err = encoding.DecodeBytesAscending(d.buf, nil /* r */)
+	if err != nil {
+		panic(err)
+	}
+	return string(s)
+}
+
+func (d *memoDecoder) readColSet() opt.ColSet {
+	var cols opt.ColSet
+	for i, n := 0, d.readLength(); i < n; i++ {
+		cols.Add(opt.ColumnID(d.readUvarint()))
+	}
+	return cols
+}
+
+func (d *memoDecoder) readColList() opt.ColList {
+	cols := make(opt.ColList, d.readLength())
+	for i := range cols {
+		cols[i] = opt.ColumnID(d.readUvarint())
+	}
+	return cols
+}
+
+func (d *memoDecoder) readOrdering() props.OrderingChoice {
+	var ordering props.OrderingChoice
+	ordering.Optional = d.readColSet()
+	if n := d.readLength(); n > 0 {
+		ordering.Columns = make([]props.OrderingColumnChoice, n)
+		for i := range ordering.Columns {
+			ordering.Columns[i].Group = d.readColSet()
+			ordering.Columns[i].Descending = d.readBool()
+		}
+	}
+	return ordering
+}
+
+func (d *memoDecoder) readType() *types.T {
+	var data []byte
+	var err error
+	d.buf, data, err = encoding.DecodeBytesAscending(d.buf, nil /* r */)
+	if err != nil {
+		panic(err)
+	}
+	typ := &types.T{}
+	if err := typ.Unmarshal(data); err != nil {
+		panic(err)
+	}
+	return typ
+}
+
+func (d *memoDecoder) readDatum(typ *types.T) tree.Datum {
+	var data []byte
+	var err error
+	d.buf, data, err = encoding.DecodeBytesAscending(d.buf, nil /* r */)
+	if err != nil {
+		panic(err)
+	}
+	datum, rest, err := rowenc.DecodeTableValue(&d.alloc, typ, data)
+	if err != nil {
+		panic(err)
+	}
+	if len(rest) != 0 {
+		panic(errors.Newf("datum of type %s has %d trailing bytes", typ, len(rest)))
+	}
+	return datum
+}
@@ -0,0 +1,274 @@
+// Copyright 2021 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package norm_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/memo"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/norm"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/testutils"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/testutils/testcat"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/xform"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/util/encoding"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+// TestEncodeMemo tests that a normalized memo can be encoded and then loaded
+// into another factory, and that the loaded memo has the same root expression
+// and physical properties.
+func TestEncodeMemo(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	cat := testcat.New()
+	for _, ddl := range []string{
+		"CREATE TABLE kv (k INT PRIMARY KEY, v INT, s STRING)",
+		"CREATE TABLE ab (a INT PRIMARY KEY, b FLOAT, INDEX (b))",
+	} {
+		if _, err := cat.ExecuteDDL(ddl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+	const fmtFlags = memo.ExprFmtHideQualifications | memo.ExprFmtHideStats | memo.ExprFmtHideCost
+
+	for _, query := range []string{
+		"SELECT k, v FROM kv WHERE k > 1 AND v IS NOT NULL",
+		"SELECT k + 1 AS x, v * 2 AS y, s || 'foo' FROM kv ORDER BY v",
+		"SELECT v, count(*), sum(k) FROM kv GROUP BY v HAVING count(*) > 1",
+		"SELECT DISTINCT ON (v) k, v FROM kv ORDER BY v, k",
+		"SELECT * FROM kv INNER LOOKUP JOIN ab ON k = a",
+		"SELECT * FROM kv LEFT JOIN ab ON k = a AND b > 1.5 WHERE s = 'foo'",
+		"SELECT k FROM kv WHERE EXISTS (SELECT * FROM ab WHERE a = k)",
+		"SELECT * FROM (VALUES (1, 'foo'), (2, 'bar')) AS t(x, y) WHERE x > 1",
+		"SELECT k FROM kv UNION SELECT a FROM ab",
+		"SELECT k FROM kv INTERSECT ALL SELECT a FROM ab",
+		"SELECT * FROM kv ORDER BY s LIMIT 5 OFFSET 2",
+		"SELECT k::STRING, NULL::INT, ARRAY[v, 1], (k, s), (k, s).@2 FROM kv",
+		"SELECT * FROM kv WHERE v IN (1, 2, 3) AND s LIKE 'a%' AND v = ANY ARRAY[4, 5]",
+		"SELECT CASE WHEN k > 0 THEN 'pos' ELSE s END, COALESCE(v, 0) FROM kv",
+		"SELECT '2021-01-01'::DATE, 1.5::DECIMAL, '{\"a\": 1}'::JSONB, 'foo' COLLATE en_US",
+	} {
+		t.Run(query, func(t *testing.T) {
+			var o xform.Optimizer
+			testutils.BuildQuery(t, &o, cat, &evalCtx, query)
+			m := o.Memo()
+			expected := memo.FormatExpr(m.RootExpr(), fmtFlags, m, cat)
+
+			data, err := norm.EncodeMemo(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var f norm.Factory
+			f.Init(&evalCtx, cat)
+			if err := f.InjectMemo(data); err != nil {
+				t.Fatal(err)
+			}
+			actual := memo.FormatExpr(f.Memo().RootExpr(), fmtFlags, f.Memo(), cat)
+			if actual != expected {
+				t.Fatalf("expected:\n%s\nactual:\n%s", expected, actual)
+			}
+			if !f.Memo().RootProps().Equals(m.RootProps()) {
+				t.Fatalf("expected root props %s, got %s", m.RootProps(), f.Memo().RootProps())
+			}
+		})
+	}
+}
+
+// TestEncodeMemoErrors tests that memos that cannot be encoded or decoded
+// produce errors.
+func TestEncodeMemoErrors(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	cat := testcat.New()
+	if _, err := cat.ExecuteDDL("CREATE TABLE kv (k INT PRIMARY KEY, v INT, s STRING)"); err != nil {
+		t.Fatal(err)
+	}
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+
+	// Function privates have no codec.
+	var o xform.Optimizer
+	testutils.BuildQuery(t, &o, cat, &evalCtx, "SELECT lower(s) FROM kv")
+	if _, err := norm.EncodeMemo(o.Memo()); err == nil ||
+		!strings.Contains(err.Error(), "cannot encode private of type *memo.FunctionPrivate") {
+		t.Fatalf("expected unknown private error, got %v", err)
+	}
+
+	testutils.BuildQuery(t, &o, cat, &evalCtx, "SELECT k FROM kv WHERE v > 1")
+	data, err := norm.EncodeMemo(o.Memo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Truncated input.
+	var f norm.Factory
+	f.Init(&evalCtx, cat)
+	if err := f.InjectMemo(data[:len(data)/2]); err == nil {
+		t.Fatal("expected error decoding truncated memo")
+	}
+
+	// Unsupported version.
+	f.Init(&evalCtx, cat)
+	if err := f.InjectMemo(append([]byte{0x90}, data[1:]...)); err == nil ||
+		!strings.Contains(err.Error(), "unsupported memo encoding version") {
+		t.Fatalf("expected version error, got %v", err)
+	}
+
+	// Tables must be resolvable in the catalog of the factory.
+	f.Init(&evalCtx, testcat.New())
+	if err := f.InjectMemo(data); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("expected unknown table error, got %v", err)
+	}
+
+	// A list length that exceeds the remaining input is rejected before the
+	// list is allocated.
+	var corrupt []byte
+	corrupt = encoding.EncodeUvarintAscending(corrupt, 1 /* version */)
+	corrupt = encoding.EncodeUvarintAscending(corrupt, 0 /* end of metadata */)
+	corrupt = encoding.EncodeUvarintAscending(corrupt, uint64(opt.ScalarListOp))
+	corrupt = encoding.EncodeUvarintAscending(corrupt, 1<<40)
+	f.Init(&evalCtx, cat)
+	if err := f.InjectMemo(corrupt); err == nil || !strings.Contains(err.Error(), "invalid list length") {
+		t.Fatalf("expected invalid list length error, got %v", err)
+	}
+}
+
+// TestEncodeMemoDependencies tests that a loaded memo depends on the tables it
+// references, so that it becomes stale when privileges on them are revoked.
+func TestEncodeMemoDependencies(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	cat := testcat.New()
+	if _, err := cat.ExecuteDDL("CREATE TABLE kv (k INT PRIMARY KEY, v INT)"); err != nil {
+		t.Fatal(err)
+	}
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+
+	var o xform.Optimizer
+	testutils.BuildQuery(t, &o, cat, &evalCtx, "SELECT k FROM kv WHERE v > 1")
+	data, err := norm.EncodeMemo(o.Memo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var f norm.Factory
+	f.Init(&evalCtx, cat)
+	if err := f.InjectMemo(data); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if isStale, err := f.Memo().IsStale(ctx, &evalCtx, cat); err != nil {
+		t.Fatal(err)
+	} else if isStale {
+		t.Fatal("loaded memo should not be stale")
+	}
+
+	cat.Table(tree.NewTableNameWithSchema("t", tree.PublicSchemaName, "kv")).Revoked = true
+	if isStale, err := f.Memo().IsStale(ctx, &evalCtx, cat); !isStale || err == nil ||
+		!strings.Contains(err.Error(), "privilege") {
+		t.Fatalf("expected loaded memo to be stale with a privilege error, got %v, %v", isStale, err)
+	}
+
+	// The memo cannot be loaded without the privilege.
+	f.Init(&evalCtx, cat)
+	if err := f.InjectMemo(data); err == nil || !strings.Contains(err.Error(), "privilege") {
+		t.Fatalf("expected privilege error, got %v", err)
+	}
+}
+
+// TestEncodeMemoUnsupportedMetadata tests that memos are not encoded or loaded
+// when they reference tables whose metadata cannot be rebuilt from the
+// catalog, or when they depend on views.
+func TestEncodeMemoUnsupportedMetadata(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+
+	for _, tc := range []struct {
+		ddl      []string
+		query    string
+		expected string
+	}{
+		{
+			ddl:      []string{"CREATE TABLE p (k INT PRIMARY KEY, v INT, INDEX (v) WHERE v > 0)"},
+			query:    "SELECT k FROM p WHERE v > 1",
+			expected: "table p has a partial index",
+		},
+		{
+			ddl:      []string{"CREATE TABLE c (k INT PRIMARY KEY, v INT CHECK (v > 0))"},
+			query:    "SELECT k FROM c WHERE v > 1",
+			expected: "table c has check constraints",
+		},
+		{
+			ddl:      []string{"CREATE TABLE c (k INT PRIMARY KEY, v INT, w INT AS (v + 1) STORED)"},
+			query:    "SELECT k FROM c WHERE v > 1",
+			expected: "table c has computed columns",
+		},
+		{
+			ddl: []string{
+				"CREATE TABLE kv (k INT PRIMARY KEY, v INT)",
+				"CREATE VIEW kvview AS SELECT k, v FROM kv",
+			},
+			query:    "SELECT k FROM kvview WHERE v > 1",
+			expected: "depends on views",
+		},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			cat := testcat.New()
+			for _, ddl := range tc.ddl {
+				if _, err := cat.ExecuteDDL(ddl); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var o xform.Optimizer
+			testutils.BuildQuery(t, &o, cat, &evalCtx, tc.query)
+			if _, err := norm.EncodeMemo(o.Memo()); err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Fatalf("expected error %q, got %v", tc.expected, err)
+			}
+		})
+	}
+
+	// A memo encoded against a table without a partial index cannot be loaded
+	// once the table has one, since exploration would need its predicate.
+	cat := testcat.New()
+	if _, err := cat.ExecuteDDL("CREATE TABLE p (k INT PRIMARY KEY, v INT, INDEX (v))"); err != nil {
+		t.Fatal(err)
+	}
+	var o xform.Optimizer
+	testutils.BuildQuery(t, &o, cat, &evalCtx, "SELECT k FROM p WHERE v > 1")
+	data, err := norm.EncodeMemo(o.Memo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f norm.Factory
+	f.Init(&evalCtx, cat)
+	if err := f.InjectMemo(data); err != nil {
+		t.Fatal(err)
+	}
+
+	partialCat := testcat.New()
+	if _, err := partialCat.ExecuteDDL(
+		"CREATE TABLE p (k INT PRIMARY KEY, v INT, INDEX (v) WHERE v > 0)",
+	); err != nil {
+		t.Fatal(err)
+	}
+	f.Init(&evalCtx, partialCat)
+	if err := f.InjectMemo(data); err == nil || !strings.Contains(err.Error(), "table p has a partial index") {
+		t.Fatalf("expected partial index error, got %v", err)
+	}
+}
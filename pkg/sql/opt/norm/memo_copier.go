@@ -0,0 +1,263 @@
+// Copyright 2021 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package norm
+
+import (
+	"github.com/cockroachdb/cockroach/pkg/sql/opt"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/constraint"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/memo"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/props"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/sql/types"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/errors"
+)
+
+// memoCopier copies expressions from a source memo into the memo of a
+// factory. Since the two memos have separate metadata, each table and column
+// of the source memo that is referenced by a copied expression is added to the
+// destination metadata the first time it is encountered, and references to it
+// are remapped to its new id. See Factory.CopyInto.
+type memoCopier struct {
+	f    *Factory
+	from *memo.Memo
+
+	// tables maps the ids of source tables to their ids in the destination
+	// memo.
+	tables map[opt.TableID]opt.TableID
+
+	// cols maps the ids of source columns to their ids in the destination memo.
+	cols opt.ColMap
+}
+
+// copyExpr copies the given expression, which belongs to the source memo, into
+// the destination memo.
+func (c *memoCopier) copyExpr(e opt.Expr) opt.Expr {
+	switch t := e.(type) {
+	case *memo.ConstExpr:
+		return c.f.ConstructConstVal(t.Value, t.Typ)
+
+	case *memo.FiltersExpr:
+		filters := make(memo.FiltersExpr, len(*t))
+		for i := range *t {
+			filters[i] = c.f.ConstructFiltersItem(c.copyScalar((*t)[i].Condition))
+		}
+		return &filters
+
+	case *memo.ProjectionsExpr:
+		projections := make(memo.ProjectionsExpr, len(*t))
+		for i := range *t {
+			projections[i] = c.f.ConstructProjectionsItem(
+				c.copyScalar((*t)[i].Element), c.mapCol((*t)[i].Col),
+			)
+		}
+		return &projections
+
+	case *memo.AggregationsExpr:
+		aggs := make(memo.AggregationsExpr, len(*t))
+		for i := range *t {
+			aggs[i] = c.f.ConstructAggregationsItem(
+				c.copyScalar((*t)[i].Agg), c.mapCol((*t)[i].Col),
+			)
+		}
+		return &aggs
+
+	case *memo.ScalarListExpr:
+		list := make(memo.ScalarListExpr, len(*t))
+		for i := range *t {
+			list[i] = c.copyScalar((*t)[i])
+		}
+		return &list
+	}
+
+	if opt.IsListOp(e) || opt.IsListItemOp(e) {
+		panic(errors.AssertionFailedf("cannot copy operator %s", log.Safe(e.Op())))
+	}
+	args := make([]interface{}, e.ChildCount(), e.ChildCount()+1)
+	for i := range args {
+		args[i] = c.copyExpr(e.Child(i))
+	}
+	if private := e.Private(); private != nil {
+		args = append(args, c.copyPrivate(private))
+	}
+	return c.f.DynamicConstruct(e.Op(), args...)
+}
+
+// copyScalar copies the given scalar expression into the destination memo.
+func (c *memoCopier) copyScalar(e opt.ScalarExpr) opt.ScalarExpr {
+	return c.copyExpr(e).(opt.ScalarExpr)
+}
+
+// copyPrivate returns a copy of the given private in which the source table
+// and column ids are remapped to destination ids. Privates that do not refer
+// to tables or columns are returned as is.
+func (c *memoCopier) copyPrivate(private interface{}) interface{} {
+	switch t := private.(type) {
+	case *opt.ColumnID:
+		col := c.mapCol(*t)
+		return &col
+
+	case *opt.ColSet:
+		cols := c.mapColSet(*t)
+		return &cols
+
+	case *props.OrderingChoice:
+		ordering := c.mapOrderingChoice(*t)
+		return &ordering
+
+	case *memo.ScanPrivate:
+		p := *t
+		p.Table = c.mapTable(t.Table)
+		p.Cols = c.mapColSet(t.Cols)
+		if t.Constraint != nil {
+			p.SetConstraint(c.f.evalCtx, &constraint.Constraint{
+				Columns: t.Constraint.Columns.RemapColumns(t.Table, p.Table),
+				Spans:   t.Constraint.Spans,
+			})
+		}
+		return &p
+
+	case *memo.GroupingPrivate:
+		p := *t
+		p.GroupingCols = c.mapColSet(t.GroupingCols)
+		p.Ordering = c.mapOrderingChoice(t.Ordering)
+		return &p
+
+	case *memo.SetPrivate:
+		return &memo.SetPrivate{
+			LeftCols:  c.mapColList(t.LeftCols),
+			RightCols: c.mapColList(t.RightCols),
+			OutCols:   c.mapColList(t.OutCols),
+		}
+
+	case *memo.ValuesPrivate:
+		return &memo.ValuesPrivate{
+			Cols: c.mapColList(t.Cols),
+			ID:   c.f.Metadata().NextUniqueID(),
+		}
+
+	case *memo.OrdinalityPrivate:
+		return &memo.OrdinalityPrivate{
+			Ordering: c.mapOrderingChoice(t.Ordering),
+			ColID:    c.mapCol(t.ColID),
+		}
+
+	case *memo.SubqueryPrivate:
+		p := *t
+		p.Ordering = c.mapOrdering(t.Ordering)
+		if t.RequestedCol != 0 {
+			p.RequestedCol = c.mapCol(t.RequestedCol)
+		}
+		return &p
+
+	case *types.T, tree.TypedExpr, *string, *opt.Operator, *memo.TupleOrdinal,
+		*memo.JoinPrivate, *memo.FunctionPrivate:
+		return private
+	}
+	panic(errors.AssertionFailedf("cannot copy private of type %T", private))
+}
+
+// mapTable returns the id of the given source table in the destination memo,
+// adding the table to the destination metadata if it has not been added yet.
+// All columns of the table are mapped to the columns of the new table, and the
+// scalar expressions in its metadata (check constraints, computed columns and
+// partial index predicates) are copied.
+func (c *memoCopier) mapTable(tabID opt.TableID) opt.TableID {
+	if newTabID, ok := c.tables[tabID]; ok {
+		return newTabID
+	}
+	md := c.f.Metadata()
+	tabMeta := c.from.Metadata().TableMeta(tabID)
+	newTabID := md.AddTable(tabMeta.Table, &tabMeta.Alias)
+	if c.tables == nil {
+		c.tables = make(map[opt.TableID]opt.TableID)
+	}
+	c.tables[tabID] = newTabID
+	for i, n := 0, tabMeta.Table.ColumnCount(); i < n; i++ {
+		c.cols.Set(int(tabID.ColumnID(i)), int(newTabID.ColumnID(i)))
+	}
+
+	md.TableMeta(newTabID).IgnoreForeignKeys = tabMeta.IgnoreForeignKeys
+	md.TableMeta(newTabID).IgnoreUniqueWithoutIndexKeys = tabMeta.IgnoreUniqueWithoutIndexKeys
+	if tabMeta.Constraints != nil {
+		md.TableMeta(newTabID).SetConstraints(c.copyScalar(tabMeta.Constraints))
+	}
+	for col, e := range tabMeta.ComputedCols {
+		md.TableMeta(newTabID).AddComputedCol(c.mapCol(col), c.copyScalar(e))
+	}
+	// Only the predicates that were built in the source memo can be copied.
+	for ord, pred := range tabMeta.PartialIndexPredicatesForFormattingOnly() {
+		md.TableMeta(newTabID).AddPartialIndexPredicate(ord, c.copyScalar(pred))
+	}
+	return newTabID
+}
+
+// mapCol returns the id of the given source column in the destination memo,
+// adding the column (or its table) to the destination metadata if it has not
+// been added yet.
+func (c *memoCopier) mapCol(col opt.ColumnID) opt.ColumnID {
+	if newCol, ok := c.cols.Get(int(col)); ok {
+		return opt.ColumnID(newCol)
+	}
+	colMeta := c.from.Metadata().ColumnMeta(col)
+	if colMeta.Table != 0 {
+		c.mapTable(colMeta.Table)
+		newCol, _ := c.cols.Get(int(col))
+		return opt.ColumnID(newCol)
+	}
+	newCol := c.f.Metadata().AddColumn(colMeta.Alias, colMeta.Type)
+	c.cols.Set(int(col), int(newCol))
+	return newCol
+}
+
+func (c *memoCopier) mapColSet(cols opt.ColSet) opt.ColSet {
+	var res opt.ColSet
+	cols.ForEach(func(col opt.ColumnID) {
+		res.Add(c.mapCol(col))
+	})
+	return res
+}
+
+func (c *memoCopier) mapColList(cols opt.ColList) opt.ColList {
+	if cols == nil {
+		return nil
+	}
+	res := make(opt.ColList, len(cols))
+	for i, col := range cols {
+		res[i] = c.mapCol(col)
+	}
+	return res
+}
+
+func (c *memoCopier) mapOrdering(ordering opt.Ordering) opt.Ordering {
+	if ordering == nil {
+		return nil
+	}
+	res := make(opt.Ordering, len(ordering))
+	for i, col := range ordering {
+		res[i] = opt.MakeOrderingColumn(c.mapCol(col.ID()), col.Descending())
+	}
+	return res
+}
+
+func (c *memoCopier) mapOrderingChoice(ordering props.OrderingChoice) props.OrderingChoice {
+	res := props.OrderingChoice{Optional: c.mapColSet(ordering.Optional)}
+	if ordering.Columns != nil {
+		res.Columns = make([]props.OrderingColumnChoice, len(ordering.Columns))
+		for i := range ordering.Columns {
+			res.Columns[i] = props.OrderingColumnChoice{
+				Group:      c.mapColSet(ordering.Columns[i].Group),
+				Descending: ordering.Columns[i].Descending,
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,70 @@
+// Copyright 2021 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package norm
+
+import (
+	"sync/atomic"
+
+	"github.com/cockroachdb/cockroach/pkg/sql/opt"
+)
+
+// Metrics counts the number of times each normalization rule has been matched
+// and applied, aggregated across all queries normalized by the factories it is
+// attached to (see Factory.SetMetrics). It is intended for telemetry about
+// which rules fire in practice.
+//
+// Counters are updated atomically, so a Metrics object can be shared by
+// factories running concurrently without locking. Counts read via Snapshot are
+// not a consistent cut across rules, which is acceptable for reporting.
+type Metrics struct {
+	matched [opt.NumRuleNames]int64
+	applied [opt.NumRuleNames]int64
+}
+
+// RuleCounts is a point-in-time copy of the counters in a Metrics object,
+// indexed by rule name.
+type RuleCounts struct {
+	Matched [opt.NumRuleNames]int64
+	Applied [opt.NumRuleNames]int64
+}
+
+// Snapshot returns a copy of the current counts.
+func (m *Metrics) Snapshot() RuleCounts {
+	var counts RuleCounts
+	for i := range m.matched {
+		counts.Matched[i] = atomic.LoadInt64(&m.matched[i])
+		counts.Applied[i] = atomic.LoadInt64(&m.applied[i])
+	}
+	return counts
+}
+
+// Add adds the given counts to the counters, so that counts collected
+// elsewhere (e.g. on another gateway) can be aggregated.
+func (m *Metrics) Add(counts *RuleCounts) {
+	for i := range m.matched {
+		if c := counts.Matched[i]; c != 0 {
+			atomic.AddInt64(&m.matched[i], c)
+		}
+		if c := counts.Applied[i]; c != 0 {
+			atomic.AddInt64(&m.applied[i], c)
+		}
+	}
+}
+
+// recordMatched increments the matched counter for the given rule.
+func (m *Metrics) recordMatched(ruleName opt.RuleName) {
+	atomic.AddInt64(&m.matched[ruleName], 1)
+}
+
+// recordApplied increments the applied counter for the given rule.
+func (m *Metrics) recordApplied(ruleName opt.RuleName) {
+	atomic.AddInt64(&m.applied[ruleName], 1)
+}
@@ -0,0 +1,115 @@
+// Copyright 2021 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package norm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/norm"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/optbuilder"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/testutils/testcat"
+	"github.com/cockroachdb/cockroach/pkg/sql/parser"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+// TestMetrics tests that factories sharing a Metrics object accumulate into
+// the same counters, and that counts survive a Snapshot/Add round trip.
+func TestMetrics(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	cat := testcat.New()
+	if _, err := cat.ExecuteDDL("CREATE TABLE kv (k INT PRIMARY KEY, v INT, s STRING)"); err != nil {
+		t.Fatal(err)
+	}
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+
+	const query = "SELECT k FROM kv WHERE NOT (v = 1)"
+
+	// build normalizes the query with the given factory, without reinitializing
+	// it.
+	build := func(f *norm.Factory) {
+		stmt, err := parser.ParseOne(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		semaCtx := tree.MakeSemaContext()
+		b := optbuilder.New(context.Background(), &semaCtx, &evalCtx, cat, f, stmt.AST)
+		if err := b.Build(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var m norm.Metrics
+	var f1, f2 norm.Factory
+	f1.SetMetrics(&m)
+	f2.SetMetrics(&m)
+
+	// Init retains the attached metrics.
+	f1.Init(&evalCtx, cat)
+	f2.Init(&evalCtx, cat)
+
+	// Each query applies NegateComparison once; both factories must report to
+	// the shared counters.
+	build(&f1)
+	build(&f2)
+	counts := m.Snapshot()
+	if n := counts.Applied[opt.NegateComparison]; n != 2 {
+		t.Fatalf("expected NegateComparison to be applied twice, got %d", n)
+	}
+	if n := counts.Matched[opt.NegateComparison]; n < 2 {
+		t.Fatalf("expected NegateComparison to be matched at least twice, got %d", n)
+	}
+
+	// Metrics must not replace user callbacks.
+	f1.Init(&evalCtx, cat)
+	var applied int
+	f1.NotifyOnAppliedRule(func(ruleName opt.RuleName, source, target opt.Expr) {
+		if ruleName == opt.NegateComparison {
+			applied++
+		}
+	})
+	build(&f1)
+	if applied != 1 {
+		t.Fatalf("expected user callback to see NegateComparison once, got %d", applied)
+	}
+
+	// Rules skipped by the user callback are matched, but not applied.
+	f2.Init(&evalCtx, cat)
+	f2.DisableOptimizations()
+	counts = m.Snapshot()
+	build(&f2)
+	after := m.Snapshot()
+	if after.Applied != counts.Applied {
+		t.Fatal("expected no rules to be applied with optimizations disabled")
+	}
+	if after.Matched[opt.NegateComparison] != counts.Matched[opt.NegateComparison]+1 {
+		t.Fatal("expected NegateComparison to be matched with optimizations disabled")
+	}
+
+	// Snapshot/Add round trip.
+	snap := m.Snapshot()
+	var merged norm.Metrics
+	merged.Add(&snap)
+	if merged.Snapshot() != snap {
+		t.Fatal("expected snapshot to round trip through Add")
+	}
+	merged.Add(&snap)
+	doubled := merged.Snapshot()
+	for i := range snap.Applied {
+		if doubled.Matched[i] != 2*snap.Matched[i] || doubled.Applied[i] != 2*snap.Applied[i] {
+			t.Fatalf("expected merged counts for %s to be doubled", opt.RuleName(i))
+		}
+	}
+}
@@ -14,10 +14,12 @@ import (
 	"fmt"
 
 	"github.com/cockroachdb/cockroach/pkg/sql/opt"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/constraint"
 	"github.com/cockroachdb/cockroach/pkg/sql/opt/memo"
 	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
 	"github.com/cockroachdb/cockroach/pkg/sql/types"
 	"github.com/cockroachdb/cockroach/pkg/util/json"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/errors"
 )
 
@@ -39,6 +41,11 @@ func (c *CustomFuncs) CanMergeProjections(outer, inner memo.ProjectionsExpr) boo
 // operator that are passed through by the outer. Note that the outer
 // synthesized columns must never contain references to the inner synthesized
 // columns; this can be verified by first calling CanMergeProjections.
+//
+// A well-formed outer Project cannot both pass through and synthesize a
+// column. MergeProjections panics if the outer projections synthesize a
+// passed-through column, since the merged projections would otherwise define
+// that column twice.
 func (c *CustomFuncs) MergeProjections(
 	outer, inner memo.ProjectionsExpr, passthrough opt.ColSet,
 ) memo.ProjectionsExpr {
@@ -46,15 +53,167 @@ func (c *CustomFuncs) MergeProjections(
 	// still be valid.
 	newProjections := make(memo.ProjectionsExpr, len(outer), len(outer)+len(inner))
 	copy(newProjections, outer)
+	outerCols := outer.OutputCols()
 	for i := range inner {
 		item := &inner[i]
 		if passthrough.Contains(item.Col) {
+			if outerCols.Contains(item.Col) {
+				panic(errors.AssertionFailedf(
+					"outer projections synthesize passthrough column %d", log.Safe(item.Col),
+				))
+			}
 			newProjections = append(newProjections, *item)
 		}
 	}
 	return newProjections
 }
 
+// CanFoldSelfArithmetic returns true if any of the given projections can be
+// folded by FoldSelfArithmetic.
+func (c *CustomFuncs) CanFoldSelfArithmetic(
+	projections memo.ProjectionsExpr, input memo.RelExpr,
+) bool {
+	for i := range projections {
+		if _, ok := c.foldSelfArithmetic(projections[i].Element, input); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// FoldSelfArithmetic returns a copy of the given projections in which each
+// projection that subtracts or divides an INT column by itself is replaced by
+// a constant. See foldSelfArithmetic for details.
+func (c *CustomFuncs) FoldSelfArithmetic(
+	projections memo.ProjectionsExpr, input memo.RelExpr,
+) memo.ProjectionsExpr {
+	newProjections := make(memo.ProjectionsExpr, len(projections))
+	for i := range projections {
+		if folded, ok := c.foldSelfArithmetic(projections[i].Element, input); ok {
+			newProjections[i] = c.f.ConstructProjectionsItem(folded, projections[i].Col)
+		} else {
+			newProjections[i] = projections[i]
+		}
+	}
+	return newProjections
+}
+
+// foldSelfArithmetic returns the constant result of the given scalar
+// expression if it subtracts or divides an INT column by itself, and ok=false
+// otherwise. The column must be not null in the given input. For division, the
+// column must also be constrained to be non-zero by a filter of the input.
+//
+// Only INT columns are folded. For FLOAT and DECIMAL columns, x - x and x / x
+// are NaN if x is infinite, and x / x depends on the precision of the division.
+func (c *CustomFuncs) foldSelfArithmetic(
+	scalar opt.ScalarExpr, input memo.RelExpr,
+) (_ opt.ScalarExpr, ok bool) {
+	var left, right opt.ScalarExpr
+	switch scalar.Op() {
+	case opt.MinusOp, opt.DivOp, opt.FloorDivOp:
+		left, right = scalar.Child(0).(opt.ScalarExpr), scalar.Child(1).(opt.ScalarExpr)
+	default:
+		return nil, false
+	}
+	v, ok := left.(*memo.VariableExpr)
+	if !ok || right != left || v.Typ.Family() != types.IntFamily {
+		return nil, false
+	}
+	if !input.Relational().NotNullCols.Contains(v.Col) {
+		return nil, false
+	}
+
+	typ := scalar.DataType()
+	switch scalar.Op() {
+	case opt.MinusOp:
+		return c.f.ConstructConstVal(tree.NewDInt(0), typ), true
+
+	case opt.DivOp:
+		if !c.colIsNeverZero(v.Col, input) {
+			return nil, false
+		}
+		return c.f.ConstructConstVal(&tree.DecimalOne, typ), true
+
+	default:
+		if !c.colIsNeverZero(v.Col, input) {
+			return nil, false
+		}
+		return c.f.ConstructConstVal(tree.NewDInt(1), typ), true
+	}
+}
+
+// colIsNeverZero returns true if the given INT column is known to never be
+// zero in the output of the given input expression, because the input is a
+// Select with a filter that constrains the column to values other than zero.
+func (c *CustomFuncs) colIsNeverZero(col opt.ColumnID, input memo.RelExpr) bool {
+	sel, ok := input.(*memo.SelectExpr)
+	if !ok {
+		return false
+	}
+	zero := constraint.MakeKey(tree.NewDInt(0))
+	var zeroSpan constraint.Span
+	zeroSpan.Init(zero, constraint.IncludeBoundary, zero, constraint.IncludeBoundary)
+	for i := range sel.Filters {
+		cs := sel.Filters[i].ScalarProps().Constraints
+		for j, n := 0, cs.Length(); j < n; j++ {
+			con := cs.Constraint(j)
+			if con.Columns.Count() != 1 || con.Columns.Get(0).ID() != col {
+				continue
+			}
+			// Since the zero span has a single key, it overlaps a span of the
+			// constraint only if it is contained by it.
+			if !con.ContainsSpan(c.f.evalCtx, &zeroSpan) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FindCommonProjectionExpr searches the given projections for a scalar
+// subexpression that is referenced more than once, and that is worth computing
+// only once. It uses the same criteria as FindCommonFilterExpr, except that
+// every projection is evaluated for each row, so a reference at the top of any
+// projection counts as unconditionally evaluated. If there are no candidates,
+// or if the HoistCommonProjectionExprs rule has not been enabled on the
+// factory, FindCommonProjectionExpr returns ok=false.
+func (c *CustomFuncs) FindCommonProjectionExpr(
+	projections memo.ProjectionsExpr,
+) (_ opt.ScalarExpr, ok bool) {
+	if !c.f.hoistCommonProjectionExprs {
+		return nil, false
+	}
+	roots := make([]opt.ScalarExpr, len(projections))
+	for i := range projections {
+		roots[i] = projections[i].Element
+	}
+	return c.findCommonExpr(roots, roots)
+}
+
+// HoistCommonProjectionExpr projects the given subexpression of the projections
+// as a new column in a Project below the given projections, and replaces each
+// reference to it in the projections with a reference to the new column. The
+// new column is not passed through, so the result has the same output columns
+// as the original Project.
+func (c *CustomFuncs) HoistCommonProjectionExpr(
+	input memo.RelExpr,
+	projections memo.ProjectionsExpr,
+	passthrough opt.ColSet,
+	common opt.ScalarExpr,
+) memo.RelExpr {
+	col := c.f.Metadata().AddColumn("common", common.DataType())
+	variable := c.f.ConstructVariable(col)
+
+	newProjections := make(memo.ProjectionsExpr, len(projections))
+	for i := range projections {
+		newProjections[i] = c.f.ConstructProjectionsItem(
+			c.replaceCommonExpr(projections[i].Element, common, variable), projections[i].Col,
+		)
+	}
+
+	return c.f.ConstructProject(c.ProjectExtraCol(input, common, col), newProjections, passthrough)
+}
+
 // MergeProjectWithValues merges a Project operator with its input Values
 // operator. This is only possible in certain circumstances, which are described
 // in the MergeProjectWithValues rule comment.
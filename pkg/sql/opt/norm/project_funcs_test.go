@@ -0,0 +1,63 @@
+// Copyright 2021 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package norm
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/memo"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/sql/types"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/errors"
+)
+
+// TestMergeProjectionsOverlap tests that MergeProjections raises an assertion
+// error when the outer projections synthesize a column that is also
+// synthesized by the inner projections and passed through by the outer
+// Project, rather than silently dropping one of the definitions.
+func TestMergeProjectionsOverlap(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+	var f Factory
+	f.Init(&evalCtx, nil /* catalog */)
+	md := f.Metadata()
+	x := md.AddColumn("x", types.Int)
+	y := md.AddColumn("y", types.Int)
+
+	one := f.ConstructConstVal(tree.NewDInt(1), types.Int)
+	two := f.ConstructConstVal(tree.NewDInt(2), types.Int)
+	outer := memo.ProjectionsExpr{f.ConstructProjectionsItem(two, x)}
+	inner := memo.ProjectionsExpr{
+		f.ConstructProjectionsItem(one, x),
+		f.ConstructProjectionsItem(one, y),
+	}
+
+	// Without overlap, the passed-through inner projection is kept.
+	merged := f.funcs.MergeProjections(outer, inner, opt.MakeColSet(y))
+	if len(merged) != 2 || merged[0].Col != x || merged[1].Col != y {
+		t.Fatalf("expected x and y to be synthesized, got %d projections", len(merged))
+	}
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatal("expected MergeProjections to panic")
+		}
+		if err, ok := r.(error); !ok || !errors.HasAssertionFailure(err) {
+			t.Fatalf("expected an assertion failure, got %v", r)
+		}
+	}()
+	f.funcs.MergeProjections(outer, inner, opt.MakeColSet(x, y))
+}
@@ -481,6 +481,12 @@ func (c *CustomFuncs) CanPruneWindows(needed opt.ColSet, windows memo.WindowsExp
 	return false
 }
 
+// CanPruneOrdinality is true if the column generated by an Ordinality operator
+// is not included in needed, meaning that the operator can be eliminated.
+func (c *CustomFuncs) CanPruneOrdinality(needed opt.ColSet, private *memo.OrdinalityPrivate) bool {
+	return !needed.Contains(private.ColID)
+}
+
 // PruneWindows restricts windows to only the columns which appear in needed.
 // If we eliminate all the window functions, EliminateWindow will trigger and
 // remove the expression entirely.
@@ -566,12 +572,13 @@ func DerivePruneCols(e memo.RelExpr) opt.ColSet {
 
 	case opt.OrdinalityOp:
 		// Any pruneable input columns can potentially be pruned, as long as
-		// they're not used as an ordering column. The new row number column
-		// cannot be pruned without adding an additional Project operator, so
-		// don't add it to the set.
+		// they're not used as an ordering column. The new row number column can
+		// also be pruned, since the Project operator that prunes it allows
+		// EliminateOrdinality to remove the Ordinality operator.
 		ord := e.(*memo.OrdinalityExpr)
 		inputPruneCols := DerivePruneCols(ord.Input)
 		relProps.Rule.PruneCols = inputPruneCols.Difference(ord.Ordering.ColSet())
+		relProps.Rule.PruneCols.Add(ord.ColID)
 
 	case opt.IndexJoinOp, opt.LookupJoinOp, opt.MergeJoinOp:
 		// There is no need to prune columns projected by Index, Lookup or Merge
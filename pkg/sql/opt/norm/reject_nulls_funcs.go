@@ -14,6 +14,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/sql/opt"
 	"github.com/cockroachdb/cockroach/pkg/sql/opt/memo"
 	"github.com/cockroachdb/cockroach/pkg/sql/opt/props"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
 	"github.com/cockroachdb/errors"
 )
 
@@ -26,11 +27,16 @@ func (c *CustomFuncs) RejectNullCols(in memo.RelExpr) opt.ColSet {
 
 // HasNullRejectingFilter returns true if the filter causes some of the columns
 // in nullRejectCols to be non-null. For example, if nullRejectCols = (x, z),
-// filters such as x < 5, x = y, and z IS NOT NULL all satisfy this property.
+// filters such as x < 5, x = y, z IS NOT NULL, and x + z > 5 all satisfy this
+// property.
 func (c *CustomFuncs) HasNullRejectingFilter(
 	filters memo.FiltersExpr, nullRejectCols opt.ColSet,
 ) bool {
 	for i := range filters {
+		if isNullRejecting(filters[i].Condition, nullRejectCols) {
+			return true
+		}
+
 		constraints := filters[i].ScalarProps().Constraints
 		if constraints == nil {
 			continue
@@ -44,6 +50,87 @@ func (c *CustomFuncs) HasNullRejectingFilter(
 	return false
 }
 
+// isNullRejecting returns true if the given condition cannot evaluate to true
+// when at least one of the given columns is NULL, because the condition is
+// strict over that column (see strictCols). A filter with such a condition
+// rejects nulls on the column.
+func isNullRejecting(cond opt.ScalarExpr, cols opt.ColSet) bool {
+	return strictCols(cond).Intersects(cols)
+}
+
+// strictCols returns the set of columns for which a NULL value causes the given
+// boolean condition to evaluate to NULL or false. This complements the not-null
+// columns derived from constraints, which are not built for conditions on
+// expressions such as x + y > 5.
+//
+// Comparisons (and IS NOT NULL tests) are strict over the columns from which a
+// NULL is transmitted to their operands (see nullTransmittingCols). A
+// conjunction is strict over the columns for which either of its operands is
+// strict, while a disjunction is only strict over the columns for which both of
+// its operands are. strictCols is conservative, and returns the empty set for
+// any other condition, such as CASE, COALESCE, or IS NULL.
+func strictCols(cond opt.ScalarExpr) opt.ColSet {
+	switch t := cond.(type) {
+	case *memo.AndExpr:
+		return strictCols(t.Left).Union(strictCols(t.Right))
+
+	case *memo.OrExpr:
+		return strictCols(t.Left).Intersection(strictCols(t.Right))
+
+	case *memo.RangeExpr:
+		return strictCols(t.And)
+
+	case *memo.NotExpr:
+		// NOT evaluates to true for a false input, so only a NULL input is
+		// guaranteed to result in NULL.
+		return nullTransmittingCols(t.Input)
+
+	case *memo.IsNotExpr:
+		if isNull(t.Right) {
+			return nullTransmittingCols(t.Left)
+		}
+		return opt.ColSet{}
+	}
+	if !opt.BoolOperatorRequiresNotNullArgs(cond.Op()) {
+		return opt.ColSet{}
+	}
+	left := nullTransmittingCols(cond.Child(0).(opt.ScalarExpr))
+	return left.Union(nullTransmittingCols(cond.Child(1).(opt.ScalarExpr)))
+}
+
+// nullTransmittingCols returns the set of columns for which a NULL value causes
+// the given scalar expression to evaluate to NULL. These are the columns that
+// are reachable from the expression through an unbroken chain of strict
+// operators: arithmetic and comparison operators that transmit nulls (see
+// opt.ScalarOperatorTransmitsNulls), casts, and normal functions that do not
+// allow NULL arguments, since those are never called with a NULL argument.
+func nullTransmittingCols(e opt.ScalarExpr) opt.ColSet {
+	var cols opt.ColSet
+	switch t := e.(type) {
+	case *memo.VariableExpr:
+		return opt.MakeColSet(t.Col)
+
+	case *memo.CastExpr:
+		return nullTransmittingCols(t.Input)
+
+	case *memo.FunctionExpr:
+		if t.Properties.NullableArgs || t.Properties.Class != tree.NormalClass {
+			return cols
+		}
+		for i := range t.Args {
+			cols.UnionWith(nullTransmittingCols(t.Args[i]))
+		}
+		return cols
+	}
+	if !opt.ScalarOperatorTransmitsNulls(e.Op()) {
+		return cols
+	}
+	for i, n := 0, e.ChildCount(); i < n; i++ {
+		cols.UnionWith(nullTransmittingCols(e.Child(i).(opt.ScalarExpr)))
+	}
+	return cols
+}
+
 // NullRejectAggVar scans through the list of aggregate functions and returns
 // the Variable input of the first aggregate that is not ConstAgg. Such an
 // aggregate must exist, since this is only called if at least one eligible
@@ -263,6 +350,99 @@ func (c *CustomFuncs) MakeNullRejectFilters(nullRejectCols opt.ColSet) memo.Filt
 	return filters
 }
 
+// ConstructNotNullFilter returns a conjunction of "col IS NOT NULL" conditions,
+// one for each column in the given ColSet. If the set is empty, it returns
+// True.
+func (c *CustomFuncs) ConstructNotNullFilter(cols opt.ColSet) opt.ScalarExpr {
+	var result opt.ScalarExpr
+	for col, ok := cols.Next(0); ok; col, ok = cols.Next(col + 1) {
+		isNotNull := c.f.ConstructIsNot(c.f.ConstructVariable(col), memo.NullSingleton)
+		if result == nil {
+			result = isNotNull
+		} else {
+			result = c.f.ConstructAnd(result, isNotNull)
+		}
+	}
+	if result == nil {
+		return memo.TrueSingleton
+	}
+	return result
+}
+
+// NullableJoinEqualityCols returns the columns of the given join input that
+// are nullable, but are constrained by an equality with a column of the other
+// input in the join's ON filters. Since the equality can never be true for a
+// NULL value, the join output only contains rows in which these columns are
+// not null.
+//
+// Only columns for which an explicit IS NOT NULL filter is likely to pay off
+// are returned; see canSkipNullsWithIndex. Otherwise the filter would not let
+// any work be skipped, and the extra Select below the join would only get in
+// the way of other rules, such as those that generate lookup joins.
+func (c *CustomFuncs) NullableJoinEqualityCols(
+	input, otherInput memo.RelExpr, on memo.FiltersExpr,
+) opt.ColSet {
+	var cols opt.ColSet
+	scan, ok := input.(*memo.ScanExpr)
+	if !ok {
+		return cols
+	}
+	inputProps := input.Relational()
+	otherCols := otherInput.Relational().OutputCols
+	for i := range on {
+		ok, col, _ := memo.ExtractJoinEquality(inputProps.OutputCols, otherCols, on[i].Condition)
+		if ok && !inputProps.NotNullCols.Contains(col) && c.canSkipNullsWithIndex(scan, col) {
+			cols.Add(col)
+		}
+	}
+	return cols
+}
+
+// minSkippedNullFraction is the minimum fraction of a column's values that
+// must be NULL, according to the table statistics, for the
+// SynthesizeJoinNotNullFilters rules to add an IS NOT NULL filter on it.
+const minSkippedNullFraction = 0.1
+
+// canSkipNullsWithIndex returns true if a "col IS NOT NULL" filter on the
+// given column of a scanned table would allow a significant number of rows to
+// be skipped by constraining an index scan. This is the case when:
+//
+//   1. The column is the first key column of one of the table's non-inverted
+//      indexes, so that the filter can become a constraint on the index.
+//
+//   2. The most recent statistic on the column shows that at least
+//      minSkippedNullFraction of its values are NULL. Without statistics the
+//      filter is not added, since most columns have few NULLs and the filter
+//      would not be selective.
+//
+func (c *CustomFuncs) canSkipNullsWithIndex(scan *memo.ScanExpr, col opt.ColumnID) bool {
+	tab := c.f.Metadata().Table(scan.Table)
+	ord := scan.Table.ColumnOrdinal(col)
+
+	isLeadingCol := false
+	for i, n := 0, tab.IndexCount(); i < n; i++ {
+		index := tab.Index(i)
+		if !index.IsInverted() && index.Column(0).Ordinal() == ord {
+			isLeadingCol = true
+			break
+		}
+	}
+	if !isLeadingCol {
+		return false
+	}
+
+	// Stats are ordered with most recent first.
+	for i, n := 0, tab.StatisticCount(); i < n; i++ {
+		stat := tab.Statistic(i)
+		if stat.ColumnCount() != 1 || stat.ColumnOrdinal(0) != ord {
+			continue
+		}
+		rowCount := float64(stat.RowCount())
+		return rowCount > 0 && float64(stat.NullCount()) >= minSkippedNullFraction*rowCount
+	}
+	return false
+}
+
 // deriveProjectRejectNullCols returns the set of Project output columns which
 // are eligible for null rejection. All passthrough columns which are in the
 // RejectNullCols set of the input can be null-rejected. In addition, projected
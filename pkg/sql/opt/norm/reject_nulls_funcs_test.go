@@ -0,0 +1,131 @@
+// Copyright 2021 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package norm
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/memo"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/builtins"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/sql/types"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+func TestIsNullRejecting(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+	var f Factory
+	f.Init(&evalCtx, nil /* catalog */)
+	md := f.Metadata()
+	xCol := md.AddColumn("x", types.Int)
+	yCol := md.AddColumn("y", types.Int)
+	sCol := md.AddColumn("s", types.String)
+
+	// Disable normalization so that the expressions keep their shape.
+	f.DisableOptimizations()
+	x := f.ConstructVariable(xCol)
+	y := f.ConstructVariable(yCol)
+	s := f.ConstructVariable(sCol)
+	one := f.ConstructConstVal(tree.NewDInt(1), types.Int)
+	str := f.ConstructConstVal(tree.NewDString("a"), types.String)
+	fn := func(name string, typ *types.T, args ...opt.ScalarExpr) opt.ScalarExpr {
+		props, overloads := builtins.GetBuiltinProperties(name)
+		for i := range overloads {
+			if overloads[i].Types.MatchAt(args[0].DataType(), 0) {
+				return f.ConstructFunction(args, &memo.FunctionPrivate{
+					Name: name, Typ: typ, Properties: props, Overload: &overloads[i],
+				})
+			}
+		}
+		t.Fatalf("could not find overload for %s", name)
+		return nil
+	}
+
+	xGtOne := f.ConstructGt(x, one)
+	yGtOne := f.ConstructGt(y, one)
+	cols := func(cols ...opt.ColumnID) opt.ColSet { return opt.MakeColSet(cols...) }
+
+	// strict is true if the condition is strict over all of the columns, which
+	// means that they are all in its strictCols. nullRejecting is true if it is
+	// strict over at least one of them.
+	testCases := []struct {
+		cond          opt.ScalarExpr
+		cols          opt.ColSet
+		strict        bool
+		nullRejecting bool
+	}{
+		// Comparisons.
+		{xGtOne, cols(xCol), true, true},
+		{xGtOne, cols(yCol), false, false},
+		{xGtOne, cols(xCol, yCol), false, true},
+		{f.ConstructEq(x, y), cols(xCol, yCol), true, true},
+		{f.ConstructLike(s, str), cols(sCol), true, true},
+		{f.ConstructIsNot(x, y), cols(xCol), false, false},
+
+		// Arithmetic.
+		{f.ConstructGt(f.ConstructPlus(x, y), one), cols(xCol), true, true},
+		{f.ConstructGt(f.ConstructPlus(x, y), one), cols(yCol), true, true},
+		{f.ConstructGt(f.ConstructPlus(x, y), one), cols(xCol, yCol), true, true},
+		{f.ConstructEq(f.ConstructMult(x, one), y), cols(xCol, yCol), true, true},
+
+		// Casts and functions.
+		{f.ConstructEq(f.ConstructCast(x, types.String), s), cols(xCol, sCol), true, true},
+		{f.ConstructGt(fn("length", types.Int, s), one), cols(sCol), true, true},
+		{f.ConstructEq(fn("concat", types.String, s, str), str), cols(sCol), false, false},
+
+		// Expressions that do not transmit nulls.
+		{f.ConstructGt(f.ConstructCoalesce(memo.ScalarListExpr{x, one}), one), cols(xCol), false, false},
+		{
+			f.ConstructEq(
+				f.ConstructCase(
+					memo.TrueSingleton,
+					memo.ScalarListExpr{f.ConstructWhen(xGtOne, one)},
+					f.ConstructNullOfType(types.Int),
+				),
+				one,
+			),
+			cols(xCol),
+			false,
+			false,
+		},
+
+		// IS [NOT] NULL.
+		{f.ConstructIs(x, memo.NullSingleton), cols(xCol), false, false},
+		{f.ConstructIs(x, memo.NullSingleton), cols(xCol, yCol), false, false},
+		{f.ConstructIsNot(x, memo.NullSingleton), cols(xCol), true, true},
+		{f.ConstructIsNot(f.ConstructPlus(x, one), memo.NullSingleton), cols(xCol), true, true},
+
+		// Boolean operators.
+		{f.ConstructNot(xGtOne), cols(xCol), true, true},
+		{f.ConstructNot(f.ConstructIs(x, memo.NullSingleton)), cols(xCol), false, false},
+		{f.ConstructAnd(xGtOne, yGtOne), cols(xCol, yCol), true, true},
+		{f.ConstructOr(xGtOne, yGtOne), cols(xCol), false, false},
+		{f.ConstructOr(xGtOne, yGtOne), cols(xCol, yCol), false, false},
+		{f.ConstructOr(xGtOne, f.ConstructLt(x, y)), cols(xCol), true, true},
+		{f.ConstructOr(xGtOne, f.ConstructLt(x, y)), cols(yCol), false, false},
+		{f.ConstructRange(f.ConstructAnd(xGtOne, f.ConstructLt(x, y))), cols(xCol, yCol), true, true},
+	}
+
+	for _, tc := range testCases {
+		if actual := tc.cols.SubsetOf(strictCols(tc.cond)); actual != tc.strict {
+			t.Errorf("%s over %s: expected strict=%t, got %t",
+				memo.FormatSExpr(tc.cond, md), tc.cols, tc.strict, actual)
+		}
+		if actual := isNullRejecting(tc.cond, tc.cols); actual != tc.nullRejecting {
+			t.Errorf("%s over %s: expected nullRejecting=%t, got %t",
+				memo.FormatSExpr(tc.cond, md), tc.cols, tc.nullRejecting, actual)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2021 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package norm
+
+import (
+	"strings"
+
+	"github.com/cockroachdb/cockroach/pkg/sql/opt"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/cat"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/memo"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/errors"
+)
+
+// CheckRuleShuffle checks that normalization of the expression constructed by
+// the given build function is confluent; that is, that the normalized
+// expression does not depend on the order in which the normalization rules are
+// applied. The expression is first built using the default rule order. It is
+// then built again for each of the given seeds with SetRuleShuffleSeed, and
+// renormalized by copying it into a new memo using the default rule order.
+// CheckRuleShuffle returns an error if any of the renormalized expressions
+// differs from the expression built using the default rule order. The error
+// includes the rules applied by both runs.
+//
+// Expressions are compared using fingerprints that include their columns and
+// logical properties, but not the ids of synthesized columns, which depend on
+// the rules that were applied; see fingerprint. CheckRuleShuffle is only
+// intended for tests, and only supports expressions that CopyInto can copy.
+func CheckRuleShuffle(
+	evalCtx *tree.EvalContext, catalog cat.Catalog, build func(f *Factory) error, seeds ...int64,
+) error {
+	var f Factory
+	var expectedTrace strings.Builder
+	f.Init(evalCtx, catalog)
+	f.SetTracer(&expectedTrace, TraceExprs)
+	if err := build(&f); err != nil {
+		return err
+	}
+	expected := fingerprint(evalCtx, catalog, f.Memo())
+
+	for _, seed := range seeds {
+		var trace strings.Builder
+		var shuffled Factory
+		shuffled.Init(evalCtx, catalog)
+		shuffled.SetTracer(&trace, TraceExprs)
+		shuffled.SetRuleShuffleSeed(seed)
+		if err := build(&shuffled); err != nil {
+			return err
+		}
+
+		// Rules declined by the shuffle are not retried, so renormalize the
+		// result by copying it with the default rule order.
+		trace.WriteString("-- renormalize --\n")
+		var renormalized Factory
+		renormalized.Init(evalCtx, catalog)
+		renormalized.SetTracer(&trace, TraceExprs)
+		var replaceFn ReplaceFunc
+		replaceFn = func(e opt.Expr) opt.Expr {
+			return renormalized.CopyAndReplaceDefault(e, replaceFn)
+		}
+		mem := shuffled.Memo()
+		renormalized.CopyAndReplace(mem.RootExpr().(memo.RelExpr), mem.RootProps(), replaceFn)
+
+		actual := fingerprint(evalCtx, catalog, renormalized.Memo())
+		if actual != expected {
+			return errors.Newf(
+				"normalization is not confluent with rule shuffle seed %d\n"+
+					"expected:\n%s\nactual:\n%s\n"+
+					"rules applied with default order:\n%s\nrules applied with seed %d:\n%s",
+				seed, expected, actual, expectedTrace.String(), seed, trace.String(),
+			)
+		}
+	}
+	return nil
+}
+
+// fingerprint returns a string that identifies the root expression of the given
+// memo, including its columns, the privates of its operators and its logical
+// properties. The expression is first copied into a new memo with all rules
+// disabled, so that its columns are assigned ids in the order in which they
+// are encountered in the expression tree. As a result, two expression trees
+// with the same structure have the same fingerprint even if their synthesized
+// columns were assigned different ids when they were built.
+func fingerprint(evalCtx *tree.EvalContext, catalog cat.Catalog, m *memo.Memo) string {
+	var f Factory
+	f.Init(evalCtx, catalog)
+	f.DisableOptimizations()
+	root := f.CopyInto(m, m.RootExpr())
+	const fmtFlags = memo.ExprFmtHideQualifications | memo.ExprFmtHideStats |
+		memo.ExprFmtHideCost | memo.ExprFmtHideRuleProps
+	return memo.FormatExpr(root, fmtFlags, f.Memo(), catalog)
+}
@@ -0,0 +1,153 @@
+// Copyright 2021 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package norm_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/norm"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/optbuilder"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/testutils/testcat"
+	"github.com/cockroachdb/cockroach/pkg/sql/parser"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+// TestCheckRuleShuffle tests that a corpus of queries is normalized to the
+// same expression regardless of the order in which rules are applied, and that
+// CheckRuleShuffle reports expressions that differ.
+func TestCheckRuleShuffle(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	cat := testcat.New()
+	if _, err := cat.ExecuteDDL("CREATE TABLE kv (k INT PRIMARY KEY, v INT, s STRING)"); err != nil {
+		t.Fatal(err)
+	}
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+
+	// builder returns a build function for CheckRuleShuffle that builds the
+	// given query.
+	builder := func(query string) func(f *norm.Factory) error {
+		return func(f *norm.Factory) error {
+			stmt, err := parser.ParseOne(query)
+			if err != nil {
+				return err
+			}
+			semaCtx := tree.MakeSemaContext()
+			b := optbuilder.New(context.Background(), &semaCtx, &evalCtx, cat, f, stmt.AST)
+			return b.Build()
+		}
+	}
+
+	seeds := []int64{1, 2, 3, 4, 5}
+
+	t.Run("corpus", func(t *testing.T) {
+		queries := []string{
+			"SELECT k FROM kv WHERE NOT (v = 1)",
+			"SELECT k, v + 1 FROM kv WHERE k > 5 AND s = 'foo'",
+			"SELECT v, count(*) FROM kv GROUP BY v",
+			"SELECT * FROM (SELECT * FROM kv WHERE v = 1) WHERE s = 'foo'",
+			"SELECT a.k FROM kv AS a JOIN kv AS b ON a.k = b.v WHERE b.s = 'foo'",
+		}
+		for _, query := range queries {
+			if err := norm.CheckRuleShuffle(&evalCtx, cat, builder(query), seeds...); err != nil {
+				t.Errorf("%s: %v", query, err)
+			}
+		}
+	})
+
+	t.Run("seeds", func(t *testing.T) {
+		// The same query must normalize to equivalent expressions under
+		// different seeds, even though the seeds decline different rules.
+		// Essential rules are never declined.
+		const query = "SELECT a.k FROM kv AS a JOIN kv AS b ON a.k = b.v WHERE b.s IN ('b', 'a')"
+		traces := make(map[string]struct{})
+		for _, seed := range seeds {
+			var trace strings.Builder
+			var f norm.Factory
+			f.Init(&evalCtx, cat)
+			f.SetTracer(&trace, norm.TraceExprs)
+			f.SetRuleShuffleSeed(seed)
+			if err := builder(query)(&f); err != nil {
+				t.Fatal(err)
+			}
+			for _, rule := range []string{
+				"NormalizeInConst", "PruneJoinLeftCols", "PruneJoinRightCols", "PruneSelectCols",
+			} {
+				if strings.Contains(trace.String(), rule+" (skipped)") {
+					t.Errorf("seed %d: essential rule %s was declined", seed, rule)
+				}
+			}
+			traces[trace.String()] = struct{}{}
+		}
+		if len(traces) < 2 {
+			t.Errorf("expected different seeds to apply rules in different orders")
+		}
+		if err := norm.CheckRuleShuffle(&evalCtx, cat, builder(query), seeds...); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("divergence", func(t *testing.T) {
+		// Build a different query after the first call, to simulate rules that
+		// are not confluent.
+		testCases := []struct {
+			first, others string
+			expected      []string
+		}{
+			{
+				first:    "SELECT k FROM kv WHERE v = 1",
+				others:   "SELECT k FROM kv WHERE v = 2",
+				expected: []string{"v:2 = 1", "v:2 = 2"},
+			},
+			{
+				// The expressions differ only in their columns.
+				first:    "SELECT k FROM kv",
+				others:   "SELECT v FROM kv",
+				expected: []string{"columns: k:1!null", "columns: v:2"},
+			},
+			{
+				// The expressions differ only in their grouping columns.
+				first:    "SELECT count(*) FROM kv GROUP BY v",
+				others:   "SELECT count(*) FROM kv GROUP BY s",
+				expected: []string{"grouping columns: v:2", "grouping columns: s:3"},
+			},
+		}
+		for _, tc := range testCases {
+			calls := 0
+			build := func(f *norm.Factory) error {
+				calls++
+				if calls == 1 {
+					return builder(tc.first)(f)
+				}
+				return builder(tc.others)(f)
+			}
+			err := norm.CheckRuleShuffle(&evalCtx, cat, build, seeds...)
+			if err == nil {
+				t.Fatalf("%s: expected error", tc.first)
+			}
+			msg := err.Error()
+			expected := append([]string{
+				"seed 1",
+				"rules applied with default order:",
+				"-- renormalize --",
+			}, tc.expected...)
+			for _, e := range expected {
+				if !strings.Contains(msg, e) {
+					t.Errorf("%s: expected %q in error, got:\n%s", tc.first, e, msg)
+				}
+			}
+		}
+	})
+}
@@ -23,24 +23,26 @@ import (
 )
 
 // NeedSortedUniqueList returns true if the given list is composed entirely of
-// constant values that are either not in sorted order or have duplicates. If
-// true, then ConstructSortedUniqueList needs to be called on the list to
-// normalize it.
+// constant values (or tuples or arrays of constant values, see
+// memo.CanExtractConstDatum) that are either not in sorted order or have
+// duplicates. If true, then ConstructSortedUniqueList needs to be called on the
+// list to normalize it.
 func (c *CustomFuncs) NeedSortedUniqueList(list memo.ScalarListExpr) bool {
 	if len(list) <= 1 {
 		return false
 	}
-	ls := listSorter{cf: c, list: list}
-	var needSortedUniqueList bool
-	for i, item := range list {
-		if !opt.IsConstValueOp(item) {
+	for _, item := range list {
+		if !memo.CanExtractConstDatum(item) {
 			return false
 		}
-		if i != 0 && !ls.less(i-1, i) {
-			needSortedUniqueList = true
+	}
+	ls := makeListSorter(c, list)
+	for i := 1; i < len(list); i++ {
+		if !ls.Less(i-1, i) {
+			return true
 		}
 	}
-	return needSortedUniqueList
+	return false
 }
 
 // ConstructSortedUniqueList sorts the given list and removes duplicates, and
@@ -52,10 +54,10 @@ func (c *CustomFuncs) ConstructSortedUniqueList(
 	// Make a copy of the list, since it needs to stay immutable.
 	newList := make(memo.ScalarListExpr, len(list))
 	copy(newList, list)
-	ls := listSorter{cf: c, list: newList}
+	ls := makeListSorter(c, newList)
 
 	// Sort the list.
-	sort.Slice(ls.list, ls.less)
+	sort.Sort(ls)
 
 	// Remove duplicates from the list.
 	n := 0
@@ -75,26 +77,192 @@ func (c *CustomFuncs) ConstructSortedUniqueList(
 	return newList, types.MakeTuple(contents)
 }
 
+// coalesceArgKind classifies an operand of a COALESCE expression according to
+// whether it is known to be null, known to never be null, or neither.
+type coalesceArgKind uint8
+
+const (
+	coalesceArgUnknown coalesceArgKind = iota
+	coalesceArgNull
+	coalesceArgNeverNull
+)
+
+// classifyCoalesceArg returns whether the given operand of a COALESCE is always
+// null, never null, or may or may not be null. Tuples and arrays are never
+// null, even if their elements are. Expressions such as x IS NULL are never
+// null regardless of their inputs.
+func (c *CustomFuncs) classifyCoalesceArg(arg opt.ScalarExpr) coalesceArgKind {
+	if isNull(arg) {
+		return coalesceArgNull
+	}
+	if c.IsNeverNull(arg) || memo.ExprIsNeverNull(arg, opt.ColSet{}) {
+		return coalesceArgNeverNull
+	}
+	return coalesceArgUnknown
+}
+
+// CanSimplifyCoalesce returns true if SimplifyCoalesce would discard at least
+// one of the given COALESCE operands. This is the case if the first operand
+// is null or never null, or if any operand before the last is never null.
+func (c *CustomFuncs) CanSimplifyCoalesce(args memo.ScalarListExpr) bool {
+	if len(args) < 2 {
+		return false
+	}
+	if c.classifyCoalesceArg(args[0]) != coalesceArgUnknown {
+		return true
+	}
+	for i := 1; i < len(args)-1; i++ {
+		if c.classifyCoalesceArg(args[i]) == coalesceArgNeverNull {
+			return true
+		}
+	}
+	return false
+}
+
 // SimplifyCoalesce discards any leading null operands, and then if the next
-// operand is a constant, replaces with that constant.
+// operand can never be null, replaces with that operand. Otherwise, operands
+// following the first operand that can never be null are discarded.
 func (c *CustomFuncs) SimplifyCoalesce(args memo.ScalarListExpr) opt.ScalarExpr {
-	for i := 0; i < len(args)-1; i++ {
-		item := args[i]
+	start := 0
+	for start < len(args)-1 && c.classifyCoalesceArg(args[start]) == coalesceArgNull {
+		start++
+	}
+	end := start
+	for end < len(args)-1 && c.classifyCoalesceArg(args[end]) != coalesceArgNeverNull {
+		end++
+	}
+
+	// If only one operand remains, return it without the wrapping COALESCE
+	// function.
+	if start == end {
+		return args[start]
+	}
+	return c.f.ConstructCoalesce(args[start : end+1])
+}
 
-		// If item is not a constant value, then its value may turn out to be
-		// null, so no more folding. Return operands from then on.
-		if !c.IsConstValueOrGroupOfConstValues(item) {
-			return c.f.ConstructCoalesce(args[i:])
+// SimplifyGreatestLeast discards the constant operands of a GREATEST or LEAST
+// function call that can never be its result: constant NULLs, which both
+// functions ignore, and all but the greatest (or least) of the other
+// constants. If only one operand remains, it is returned without the wrapping
+// function. SimplifyGreatestLeast returns ok=false if the function is not
+// GREATEST or LEAST, or if no operands can be discarded.
+func (c *CustomFuncs) SimplifyGreatestLeast(
+	args memo.ScalarListExpr, private *memo.FunctionPrivate,
+) (_ opt.ScalarExpr, ok bool) {
+	var greatest bool
+	switch private.Name {
+	case "greatest":
+		greatest = true
+	case "least":
+	default:
+		return nil, false
+	}
+
+	// Find the constant that dominates all other non-NULL constants.
+	best := -1
+	var bestDatum tree.Datum
+	numConsts := 0
+	for i := range args {
+		if !c.IsConstValueOrGroupOfConstValues(args[i]) {
+			continue
+		}
+		numConsts++
+		d := memo.ExtractConstDatum(args[i])
+		if d == tree.DNull {
+			continue
 		}
+		if best != -1 {
+			cmp := d.Compare(c.f.evalCtx, bestDatum)
+			if (greatest && cmp <= 0) || (!greatest && cmp >= 0) {
+				continue
+			}
+		}
+		best, bestDatum = i, d
+	}
 
-		if item.Op() != opt.NullOp {
-			return item
+	// All-constant calls are left to FoldFunction.
+	if numConsts == len(args) {
+		return nil, false
+	}
+	keep := len(args) - numConsts
+	if best != -1 {
+		keep++
+	}
+	if keep == len(args) {
+		return nil, false
+	}
+
+	newArgs := make(memo.ScalarListExpr, 0, keep)
+	for i := range args {
+		if i == best || !c.IsConstValueOrGroupOfConstValues(args[i]) {
+			newArgs = append(newArgs, args[i])
 		}
 	}
+	if len(newArgs) == 1 && newArgs[0].DataType().Identical(private.Typ) {
+		return newArgs[0], true
+	}
+	return c.f.ConstructFunction(newArgs, private), true
+}
+
+// idempotentFuncs contains the names of functions that take a single argument
+// and for which f(f(x)) = f(x). It is used by FoldIdempotentFunc.
+var idempotentFuncs = map[string]struct{}{
+	"abs":   {},
+	"btrim": {},
+	"ceil":  {},
+	"floor": {},
+	"lower": {},
+	"ltrim": {},
+	"rtrim": {},
+	"trunc": {},
+	"upper": {},
+}
+
+// IsNestedIdempotentFunction returns true if the function described by private
+// is idempotent, and arg is a single-argument call to the same function that
+// returns the same type.
+func (c *CustomFuncs) IsNestedIdempotentFunction(
+	private *memo.FunctionPrivate, arg opt.ScalarExpr,
+) bool {
+	if _, ok := idempotentFuncs[private.Name]; !ok {
+		return false
+	}
+	fn, ok := arg.(*memo.FunctionExpr)
+	return ok && fn.Name == private.Name && len(fn.Args) == 1 && fn.Typ.Identical(private.Typ)
+}
 
-	// All operands up to the last were null (or the last is the only operand),
-	// so return the last operand without the wrapping COALESCE function.
-	return args[len(args)-1]
+// IsEmptyString returns true if the given scalar expression is a constant
+// empty STRING or BYTES value.
+//
+// Collated strings are deliberately not matched. Whether a collated string is
+// "empty" depends on the equality rules of its collation, under which strings
+// made up of ignorable characters can compare equal to the empty string, so
+// concatenations of collated strings are left alone for now.
+func (c *CustomFuncs) IsEmptyString(scalar opt.ScalarExpr) bool {
+	constExpr, ok := scalar.(*memo.ConstExpr)
+	if !ok {
+		return false
+	}
+	switch t := constExpr.Value.(type) {
+	case *tree.DString:
+		return len(*t) == 0
+	case *tree.DBytes:
+		return len(*t) == 0
+	}
+	return false
+}
+
+// HaveSameStringOrBytesType returns true if the given scalar expressions have
+// identical types in the STRING or BYTES family. Concatenating two such
+// expressions results in a value of that same type, so operands of the
+// concatenation can be discarded or regrouped without changing its type.
+func (c *CustomFuncs) HaveSameStringOrBytesType(left, right opt.ScalarExpr) bool {
+	typ := left.DataType()
+	switch typ.Family() {
+	case types.StringFamily, types.BytesFamily:
+		return typ.Identical(right.DataType())
+	}
+	return false
 }
 
 // IsConstValueEqual returns whether const1 and const2 are equal.
@@ -194,11 +362,35 @@ func (c *CustomFuncs) SimplifyWhens(
 	return c.f.ConstructCase(condition, newWhens, orElse)
 }
 
+// CaseBranchesAreIdentical returns true if the value of every WHEN branch in
+// a CASE expression is the same expression as its ELSE value, and neither the
+// CASE input nor any of the WHEN conditions is volatile. In that case, the CASE
+// expression always evaluates to the ELSE value. Note that the ELSE value of a
+// CASE without an ELSE clause is NULL, so it only has identical branches if
+// every WHEN value is NULL as well.
+func (c *CustomFuncs) CaseBranchesAreIdentical(
+	input opt.ScalarExpr, whens memo.ScalarListExpr, orElse opt.ScalarExpr,
+) bool {
+	if !c.IsNonVolatile(input) {
+		return false
+	}
+	for _, item := range whens {
+		when := item.(*memo.WhenExpr)
+		if when.Value != orElse {
+			return false
+		}
+		if !c.IsNonVolatile(when.Condition) {
+			return false
+		}
+	}
+	return true
+}
+
 // ensureTyped makes sure that any NULL passing through gets tagged with an
 // appropriate type.
 func (c *CustomFuncs) ensureTyped(d opt.ScalarExpr, typ *types.T) opt.ScalarExpr {
 	if d.DataType().Family() == types.UnknownFamily {
-		return c.f.ConstructNull(typ)
+		return c.f.ConstructNullOfType(typ)
 	}
 	return d
 }
@@ -221,6 +413,65 @@ func (c *CustomFuncs) ConvertConstArrayToTuple(scalar opt.ScalarExpr) opt.Scalar
 	return c.f.ConstructTuple(elems, types.MakeTuple(ts))
 }
 
+// maxExpandAnyScalarTupleElems is the maximum number of tuple elements for
+// which ExpandAnyScalarTuple expands a scalar ANY operation. The expansion
+// duplicates the input once per element, so it is limited to small tuples.
+const maxExpandAnyScalarTupleElems = 10
+
+// CanExpandAnyScalarTuple returns true if a scalar ANY operation comparing the
+// given input with each of the given tuple elements can be expanded into a
+// disjunction of comparisons. There must be at most maxExpandAnyScalarTupleElems
+// elements, all elements must be constants, each comparison must have an
+// overload, and the input must be safe to duplicate.
+func (c *CustomFuncs) CanExpandAnyScalarTuple(
+	input opt.ScalarExpr, elems memo.ScalarListExpr, cmp opt.Operator,
+) bool {
+	if len(elems) > maxExpandAnyScalarTupleElems {
+		return false
+	}
+	if !c.IsListOfConstants(elems) {
+		return false
+	}
+	if !c.IsNonVolatile(input) || c.sharedProps(input).HasSubquery {
+		return false
+	}
+	for i := range elems {
+		if isNull(elems[i]) {
+			continue
+		}
+		if _, _, _, ok := memo.FindComparisonOverload(
+			cmp, input.DataType(), elems[i].DataType(),
+		); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// ExpandAnyScalarTuple returns the disjunction of comparing the input with each
+// of the given elements using the given comparison operator. A NULL element
+// contributes a NULL disjunct. If there are no elements, it returns False,
+// since ANY over an empty tuple is always false.
+func (c *CustomFuncs) ExpandAnyScalarTuple(
+	input opt.ScalarExpr, elems memo.ScalarListExpr, cmp opt.Operator,
+) opt.ScalarExpr {
+	var result opt.ScalarExpr = memo.FalseSingleton
+	for i := range elems {
+		var cmpExpr opt.ScalarExpr
+		if isNull(elems[i]) {
+			cmpExpr = c.f.ConstructNullOfType(types.Bool)
+		} else {
+			cmpExpr = c.f.DynamicConstruct(cmp, input, elems[i]).(opt.ScalarExpr)
+		}
+		if i == 0 {
+			result = cmpExpr
+		} else {
+			result = c.f.ConstructOr(result, cmpExpr)
+		}
+	}
+	return result
+}
+
 // CastToCollatedString returns the given string or collated string as a
 // collated string constant with the given locale.
 func (c *CustomFuncs) CastToCollatedString(str opt.ScalarExpr, locale string) opt.ScalarExpr {
@@ -0,0 +1,82 @@
+// Copyright 2021 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package norm_test
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/norm"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/testutils/testcat"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/sql/types"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+// TestConcatFuncs tests the custom functions used by the Concat rules. Collated
+// strings cannot be concatenated in SQL, so the guards against them can only be
+// exercised directly.
+func TestConcatFuncs(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+	var f norm.Factory
+	f.Init(&evalCtx, testcat.New())
+	c := f.CustomFuncs()
+
+	collatedTyp := types.MakeCollatedString(types.String, "en")
+	emptyCollated, err := tree.NewDCollatedString("", "en", &evalCtx.CollationEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strVar := f.ConstructVariable(f.Metadata().AddColumn("s", types.String))
+
+	emptyStrings := []struct {
+		e        opt.ScalarExpr
+		expected bool
+	}{
+		{e: f.ConstructConstVal(tree.NewDString(""), types.String), expected: true},
+		{e: f.ConstructConstVal(tree.NewDBytes(""), types.Bytes), expected: true},
+		{e: f.ConstructConstVal(tree.NewDString("a"), types.String), expected: false},
+		{e: f.ConstructConstVal(tree.NewDBytes("a"), types.Bytes), expected: false},
+		{e: f.ConstructConstVal(emptyCollated, collatedTyp), expected: false},
+		{e: f.ConstructNullOfType(types.String), expected: false},
+		{e: strVar, expected: false},
+	}
+	for _, tc := range emptyStrings {
+		if actual := c.IsEmptyString(tc.e); actual != tc.expected {
+			t.Errorf("expected IsEmptyString(%v) to be %v", tc.e, tc.expected)
+		}
+	}
+
+	sameTypes := []struct {
+		left, right *types.T
+		expected    bool
+	}{
+		{left: types.String, right: types.String, expected: true},
+		{left: types.Bytes, right: types.Bytes, expected: true},
+		{left: types.String, right: types.VarChar, expected: false},
+		{left: types.String, right: types.Bytes, expected: false},
+		{left: collatedTyp, right: collatedTyp, expected: false},
+		{left: types.StringArray, right: types.StringArray, expected: false},
+		{left: types.Jsonb, right: types.Jsonb, expected: false},
+	}
+	for _, tc := range sameTypes {
+		left := f.ConstructNullOfType(tc.left)
+		right := f.ConstructNullOfType(tc.right)
+		if actual := c.HaveSameStringOrBytesType(left, right); actual != tc.expected {
+			t.Errorf(
+				"expected HaveSameStringOrBytesType(%s, %s) to be %v", tc.left, tc.right, tc.expected,
+			)
+		}
+	}
+}
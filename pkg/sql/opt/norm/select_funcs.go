@@ -12,7 +12,10 @@ package norm
 
 import (
 	"github.com/cockroachdb/cockroach/pkg/sql/opt"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/constraint"
 	"github.com/cockroachdb/cockroach/pkg/sql/opt/memo"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/sql/types"
 	"github.com/cockroachdb/cockroach/pkg/util"
 	"github.com/cockroachdb/errors"
 )
@@ -278,9 +281,10 @@ func (c *CustomFuncs) SortFilters(f memo.FiltersExpr) memo.FiltersExpr {
 // conditions into a new FiltersExpr list. If, after simplification, no operands
 // remain, then SimplifyFilters returns an empty FiltersExpr.
 //
-// This method assumes that the NormalizeNestedAnds rule has already run and
-// ensured a left deep And tree. If not (maybe because it's a testing scenario),
-// then this rule may rematch, but it should still make forward progress).
+// And operators are flattened however deeply they are nested, including when
+// they are revealed by simplifying an Or or Is operator. This matters when the
+// NormalizeNestedAnds rule has not run on a condition, e.g. because it was
+// built by CopyAndReplace or DynamicConstruct while rules were disabled.
 func (c *CustomFuncs) SimplifyFilters(filters memo.FiltersExpr) memo.FiltersExpr {
 	// Start by counting the number of conjuncts that will be flattened so that
 	// the capacity of the FiltersExpr list can be determined.
@@ -303,6 +307,12 @@ func (c *CustomFuncs) SimplifyFilters(filters memo.FiltersExpr) memo.FiltersExpr
 		}
 	}
 
+	// If nothing was simplified, return the original list so that callers that
+	// do not first check whether the filters can be simplified, such as
+	// testutils.BuildFilters, do not construct a redundant copy of it.
+	if newFilters.Equals(filters) {
+		return filters
+	}
 	return newFilters
 }
 
@@ -316,7 +326,7 @@ func (c *CustomFuncs) IsUnsimplifiableOr(item *memo.FiltersItem) bool {
 	if !ok {
 		return false
 	}
-	return or.Left.Op() != opt.NullOp && or.Right.Op() != opt.NullOp
+	return !isNull(or.Left) && !isNull(or.Right)
 }
 
 // IsUnsimplifiableIs returns true if this is an IS where the right side is not
@@ -328,12 +338,13 @@ func (c *CustomFuncs) IsUnsimplifiableIs(item *memo.FiltersItem) bool {
 	if !ok {
 		return false
 	}
-	return is.Right.Op() != opt.TrueOp && is.Right.Op() != opt.FalseOp
+	return !isTrue(is.Right) && !isFalse(is.Right)
 }
 
 // addConjuncts recursively walks a scalar expression as long as it continues to
-// find nested And operators. It adds any conjuncts (ignoring True operators) to
-// the given FiltersExpr and returns true. If it finds a False or Null operator,
+// find nested And operators, or Or and Is operators that simplify to one of
+// their inputs. It adds any conjuncts (ignoring True operators) to the given
+// FiltersExpr and returns true. If it finds a False or Null operator,
 // it propagates a false return value all the up the call stack, and
 // SimplifyFilters maps that to a FiltersExpr that is always false.
 func (c *CustomFuncs) addConjuncts(
@@ -356,10 +367,10 @@ func (c *CustomFuncs) addConjuncts(
 
 	case *memo.OrExpr:
 		// If NULL is on either side, take the other side.
-		if t.Left.Op() == opt.NullOp {
-			filters = append(filters, c.f.ConstructFiltersItem(t.Right))
-		} else if t.Right.Op() == opt.NullOp {
-			filters = append(filters, c.f.ConstructFiltersItem(t.Left))
+		if isNull(t.Left) {
+			return c.addConjuncts(t.Right, filters)
+		} else if isNull(t.Right) {
+			return c.addConjuncts(t.Left, filters)
 		} else {
 			filters = append(filters, c.f.ConstructFiltersItem(t))
 		}
@@ -371,12 +382,12 @@ func (c *CustomFuncs) addConjuncts(
 		// Null input. However, in this case the replacement is valid because Select
 		// and Join operators treat False and Null filter conditions the same way
 		// (no rows returned).
-		if t.Right.Op() == opt.TrueOp {
+		if isTrue(t.Right) {
 			// <expr> IS True => <expr>
-			filters = append(filters, c.f.ConstructFiltersItem(t.Left))
-		} else if t.Right.Op() == opt.FalseOp {
+			return c.addConjuncts(t.Left, filters)
+		} else if isFalse(t.Right) {
 			// <expr> IS False => NOT <expr>
-			filters = append(filters, c.f.ConstructFiltersItem(c.f.ConstructNot(t.Left)))
+			return c.addConjuncts(c.f.ConstructNot(t.Left), filters)
 		} else {
 			// No replacement possible.
 			filters = append(filters, c.f.ConstructFiltersItem(t))
@@ -387,3 +398,320 @@ func (c *CustomFuncs) addConjuncts(
 	}
 	return filters, true
 }
+
+// CanConvertIsToComparison returns true if an IS [NOT] DISTINCT FROM comparison
+// with the given constant can be expressed with the = or <> operators. This is
+// not the case for tuples and arrays, because = and IS NOT DISTINCT FROM treat
+// NULL elements within them differently.
+func (c *CustomFuncs) CanConvertIsToComparison(right opt.ScalarExpr) bool {
+	cnst, ok := right.(*memo.ConstExpr)
+	if !ok || cnst.Value == tree.DNull {
+		return false
+	}
+	switch cnst.Typ.Family() {
+	case types.TupleFamily, types.ArrayFamily:
+		return false
+	}
+	return true
+}
+
+// ConstructIsDistinctFromConst constructs the inequality that is equivalent to
+// "left IS DISTINCT FROM right", where right is a non-null constant. If left is
+// known to be not null, this is just "left <> right". Otherwise, it is
+// "left <> right OR left IS NULL".
+func (c *CustomFuncs) ConstructIsDistinctFromConst(
+	left, right opt.ScalarExpr, leftNotNull bool,
+) opt.ScalarExpr {
+	ne := c.f.ConstructNe(left, right)
+	if leftNotNull {
+		return ne
+	}
+	return c.f.ConstructOr(ne, c.f.ConstructIs(left, memo.NullSingleton))
+}
+
+// CanFoldSelfComparison returns true if the given comparison operands are the
+// same expression, and the expression is not volatile. Since scalar
+// expressions are interned, the operands are the same expression if they are
+// the same instance. Tuples and arrays are not folded, since comparing them
+// with themselves can return NULL even when they are not NULL themselves, if
+// they have NULL elements.
+func (c *CustomFuncs) CanFoldSelfComparison(left, right opt.ScalarExpr) bool {
+	if left != right {
+		return false
+	}
+	switch left.DataType().Family() {
+	case types.TupleFamily, types.ArrayFamily, types.UnknownFamily:
+		return false
+	}
+	return c.IsNonVolatile(left)
+}
+
+// FoldSelfComparison returns the replacement for a filter condition of a
+// Select with the given input, which compares an expression with itself. See
+// the FoldSelfComparison rule for details.
+func (c *CustomFuncs) FoldSelfComparison(cmp opt.ScalarExpr, input memo.RelExpr) opt.ScalarExpr {
+	switch cmp.Op() {
+	case opt.EqOp, opt.LeOp, opt.GeOp:
+		e := cmp.Child(0).(opt.ScalarExpr)
+		if c.ExprIsNeverNull(e, input.Relational().NotNullCols) {
+			return memo.TrueSingleton
+		}
+		return c.f.ConstructIsNot(e, memo.NullSingleton)
+	}
+	return memo.FalseSingleton
+}
+
+// IsFilterImpliedByCheckConstraints returns true if the given filter is known
+// to be true for every row of the table scanned by the given Scan, because the
+// table's check constraints (see TableMeta.Constraints) imply it. This is a
+// deliberately conservative implication prover, which only reasons about the
+// constraints that the filter and the check constraints place on a single
+// column: the filter is implied if its constraint is tight, and it contains the
+// intersection of the constraints of the check constraints on the same column.
+// For example, the check constraint x > 0 implies x > -5.
+//
+// Filters and check constraints that constrain more than one column, such as
+// (x, y) > (1, 2), are ignored. The check constraints in the table metadata
+// never evaluate to NULL, so they are known to be true for every row.
+//
+// Note that filters that contradict the check constraints are not folded to
+// False. SCRUB finds rows that violate a check constraint with a query of the
+// form WHERE NOT (check), which contradicts the constraint, but which must
+// still scan the table. That query is never implied by the check constraints,
+// so it is not affected by this function.
+func (c *CustomFuncs) IsFilterImpliedByCheckConstraints(
+	item *memo.FiltersItem, scanPrivate *memo.ScanPrivate,
+) bool {
+	tabMeta := c.f.Metadata().TableMeta(scanPrivate.Table)
+	if tabMeta.Constraints == nil {
+		return false
+	}
+	filterProps := item.ScalarProps()
+	if !filterProps.TightConstraints {
+		return false
+	}
+	col, ok := singleColumnConstraint(filterProps.Constraints)
+	if !ok {
+		return false
+	}
+
+	// Intersect the constraints that the check constraints place on the column.
+	var checkCons *constraint.Set
+	checks := *tabMeta.Constraints.(*memo.FiltersExpr)
+	for i := range checks {
+		cons := checks[i].ScalarProps().Constraints
+		if checkCol, ok := singleColumnConstraint(cons); !ok || checkCol != col {
+			continue
+		}
+		if checkCons == nil {
+			checkCons = cons
+		} else {
+			checkCons = checkCons.Intersect(c.f.evalCtx, cons)
+		}
+	}
+	if checkCons == nil || checkCons == constraint.Contradiction {
+		return false
+	}
+	return filterProps.Constraints.Constraint(0).Contains(c.f.evalCtx, checkCons.Constraint(0))
+}
+
+// singleColumnConstraint returns the column of the given constraint set if it
+// consists of a single constraint on a single column.
+func singleColumnConstraint(cs *constraint.Set) (_ opt.ColumnID, ok bool) {
+	if cs == nil || cs.Length() != 1 || cs.Constraint(0).Columns.Count() != 1 {
+		return 0, false
+	}
+	return cs.Constraint(0).Columns.Get(0).ID(), true
+}
+
+// FindCommonFilterExpr searches the given filters for a scalar subexpression
+// that is referenced more than once, and that is worth computing only once.
+// Since scalar expressions are interned by the memo, repeated references to the
+// same subexpression share the same instance. A subexpression qualifies if:
+//
+//   1. It is not cheap enough to inline (see CanInline). Cheap expressions are
+//      not worth an extra column, and projecting them would only cause
+//      PushSelectIntoInlinableProject to inline them again.
+//   2. It is not volatile, since it must produce the same result for each
+//      reference.
+//   3. It does not contain a subquery.
+//   4. It cannot cause an error (it is leak-proof), or at least one reference
+//      to it is evaluated for every row. The hoisted expression is evaluated
+//      for every input row, so an expression that can error must not be
+//      hoisted if all of its references are only evaluated conditionally. For
+//      example, in
+//
+//        CASE WHEN x = 0 THEN false WHEN x > 0 THEN 10/x > 1 ELSE 10/x < -1 END
+//
+//      10/x is never evaluated when x = 0, but hoisting it would cause a
+//      division by zero error for those rows. Only the first filter is treated
+//      as evaluated for every row, since the remaining filters may be skipped
+//      once a filter evaluates to false.
+//
+// If there are several candidates, the first one found in a pre-order walk of
+// the filters is returned, which favors the largest subexpressions. If there
+// are no candidates, or if the HoistCommonFilterExprs rule has not been enabled
+// on the factory, FindCommonFilterExpr returns ok=false.
+func (c *CustomFuncs) FindCommonFilterExpr(
+	filters memo.FiltersExpr,
+) (_ opt.ScalarExpr, ok bool) {
+	if !c.f.hoistCommonFilterExprs || len(filters) == 0 {
+		return nil, false
+	}
+	roots := make([]opt.ScalarExpr, len(filters))
+	for i := range filters {
+		roots[i] = filters[i].Condition
+	}
+	return c.findCommonExpr(roots, roots[:1])
+}
+
+// findCommonExpr searches the given scalar expression trees for a
+// subexpression that is worth computing only once. The unconditional roots are
+// the subset of roots that are evaluated for every row. See
+// FindCommonFilterExpr for the criteria.
+func (c *CustomFuncs) findCommonExpr(
+	roots, unconditionalRoots []opt.ScalarExpr,
+) (_ opt.ScalarExpr, ok bool) {
+	// Count the references to each subexpression, and remember the order in
+	// which they were first seen so that the result is deterministic.
+	counts := make(map[opt.ScalarExpr]int)
+	var order []opt.ScalarExpr
+	var walk func(e opt.Expr)
+	walk = func(e opt.Expr) {
+		if _, ok := e.(memo.RelExpr); ok {
+			// Do not look inside subqueries.
+			return
+		}
+		if scalar, ok := e.(opt.ScalarExpr); ok && e.Op() != opt.ScalarListOp {
+			if counts[scalar] == 0 {
+				order = append(order, scalar)
+			}
+			counts[scalar]++
+		}
+		for i, n := 0, e.ChildCount(); i < n; i++ {
+			walk(e.Child(i))
+		}
+	}
+	for _, root := range roots {
+		walk(root)
+	}
+
+	var unconditional map[opt.Expr]struct{}
+	for _, e := range order {
+		if counts[e] < 2 || c.CanInline(e) {
+			continue
+		}
+		shared := c.sharedProps(e)
+		if !c.IsNonVolatile(e) || shared.HasSubquery {
+			continue
+		}
+		if !shared.VolatilitySet.IsLeakProof() {
+			if unconditional == nil {
+				unconditional = make(map[opt.Expr]struct{})
+				for _, root := range unconditionalRoots {
+					collectUnconditionalExprs(root, unconditional)
+				}
+			}
+			if _, ok := unconditional[e]; !ok {
+				continue
+			}
+		}
+		return e, true
+	}
+	return nil, false
+}
+
+// collectUnconditionalExprs adds e and those of its subexpressions that are
+// always evaluated when e is evaluated to the given set. Operands that may be
+// skipped during evaluation, such as the branches of a CASE, the right side of
+// AND and OR, or the operands of COALESCE after the first, are not added (nor
+// are their subexpressions). This is conservative: only the first operand of
+// most operators is considered, since for example a binary operator does not
+// evaluate its right operand when its left operand is NULL. Subqueries are not
+// searched.
+func collectUnconditionalExprs(e opt.Expr, set map[opt.Expr]struct{}) {
+	if _, ok := e.(memo.RelExpr); ok {
+		return
+	}
+	set[e] = struct{}{}
+	switch t := e.(type) {
+	case *memo.FunctionExpr:
+		// Unless the function accepts NULL arguments, evaluation stops at the
+		// first argument that is NULL, so only the first argument is always
+		// evaluated.
+		if !t.Properties.NullableArgs {
+			if len(t.Args) > 0 {
+				collectUnconditionalExprs(t.Args[0], set)
+			}
+			break
+		}
+		for _, arg := range t.Args {
+			collectUnconditionalExprs(arg, set)
+		}
+
+	case *memo.TupleExpr:
+		for _, elem := range t.Elems {
+			collectUnconditionalExprs(elem, set)
+		}
+
+	case *memo.ArrayExpr:
+		for _, elem := range t.Elems {
+			collectUnconditionalExprs(elem, set)
+		}
+
+	case *memo.CoalesceExpr:
+		collectUnconditionalExprs(t.Args[0], set)
+
+	case *memo.IfErrExpr:
+		// Errors raised by the operands are caught, so none of them can be
+		// hoisted out of the IFERROR.
+
+	default:
+		if e.ChildCount() > 0 {
+			collectUnconditionalExprs(e.Child(0), set)
+		}
+	}
+}
+
+// replaceCommonExpr replaces each reference to the given common subexpression
+// in the given scalar expression with the given replacement. Subqueries are not
+// searched.
+func (c *CustomFuncs) replaceCommonExpr(
+	e opt.ScalarExpr, common, replacement opt.ScalarExpr,
+) opt.ScalarExpr {
+	var replace ReplaceFunc
+	replace = func(e opt.Expr) opt.Expr {
+		if e == common {
+			return replacement
+		}
+		if _, ok := e.(memo.RelExpr); ok {
+			return e
+		}
+		return c.f.Replace(e, replace)
+	}
+	return replace(e).(opt.ScalarExpr)
+}
+
+// HoistCommonFilterExpr projects the given subexpression of the filters as a
+// new column below the Select, and replaces each reference to it in the filters
+// with a reference to the new column. The new column is then projected away, so
+// the result has the same output columns as the original Select.
+func (c *CustomFuncs) HoistCommonFilterExpr(
+	input memo.RelExpr, filters memo.FiltersExpr, common opt.ScalarExpr,
+) memo.RelExpr {
+	col := c.f.Metadata().AddColumn("common", common.DataType())
+	variable := c.f.ConstructVariable(col)
+
+	newFilters := make(memo.FiltersExpr, len(filters))
+	for i := range filters {
+		newFilters[i] = c.f.ConstructFiltersItem(
+			c.replaceCommonExpr(filters[i].Condition, common, variable),
+		)
+	}
+
+	return c.f.ConstructProject(
+		c.f.ConstructSelect(c.ProjectExtraCol(input, common, col), newFilters),
+		memo.EmptyProjectionsExpr,
+		input.Relational().OutputCols,
+	)
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package norm
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cockroachdb/cockroach/pkg/sql/opt"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/memo"
+)
+
+// TraceVerbosity controls how much detail a Tracer writes for each rule.
+type TraceVerbosity int
+
+const (
+	// TraceRuleNames writes one line per applied rule, containing only the
+	// name of the rule.
+	TraceRuleNames TraceVerbosity = iota
+
+	// TraceExprs additionally writes the matched and resulting expressions of
+	// each applied rule in the one-line form of Factory.FormatExprOneLine, and
+	// notes rules that were matched but skipped by a user-installed
+	// MatchedRuleFunc or the rule shuffle.
+	TraceExprs
+
+	// TraceTrees additionally writes the full tree of the resulting expression
+	// of each applied rule.
+	TraceTrees
+)
+
+// Tracer writes a trace of the normalization rules applied by a Factory to an
+// io.Writer. It is installed with Factory.SetTracer, and is useful when
+// debugging why a query was (or was not) normalized in a particular way.
+//
+// The Tracer is driven by the same events as the factory's matched and applied
+// rule callbacks. Callbacks installed with NotifyOnMatchedRule and
+// NotifyOnAppliedRule are still invoked while the Tracer is installed, so the
+// Tracer does not interfere with callers (such as the opttester) that rely on
+// those callbacks.
+type Tracer struct {
+	f         *Factory
+	w         io.Writer
+	verbosity TraceVerbosity
+}
+
+// skippedRule is called when a rule was matched, but a user-installed
+// MatchedRuleFunc or the rule shuffle prevented it from being applied.
+func (t *Tracer) skippedRule(ruleName opt.RuleName) {
+	if t.verbosity >= TraceExprs {
+		fmt.Fprintf(t.w, "%s (skipped)\n", ruleName)
+	}
+}
+
+// appliedRule is called each time a rule has been applied.
+//
+// Normalization rules match the arguments of a constructor rather than an
+// expression in the memo, so the factory does not pass a source expression to
+// its callbacks. The matched expression is therefore only written when the
+// caller provides one, as the exploration callbacks do.
+func (t *Tracer) appliedRule(ruleName opt.RuleName, source, target opt.Expr) {
+	fmt.Fprintf(t.w, "%s\n", ruleName)
+	if t.verbosity >= TraceExprs {
+		if source != nil {
+			fmt.Fprintf(t.w, "  matched: %s\n", t.f.FormatExprOneLine(source))
+		}
+		if target != nil {
+			fmt.Fprintf(t.w, "  result:  %s\n", t.f.FormatExprOneLine(target))
+		}
+	}
+	if t.verbosity >= TraceTrees && target != nil {
+		tree := t.f.FormatExpr(target, memo.ExprFmtHideAll)
+		for _, line := range strings.Split(strings.TrimRight(tree, "\n"), "\n") {
+			fmt.Fprintf(t.w, "    %s\n", line)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2021 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package norm_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/norm"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/optbuilder"
+	"github.com/cockroachdb/cockroach/pkg/sql/opt/testutils/testcat"
+	"github.com/cockroachdb/cockroach/pkg/sql/parser"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+// TestTracer tests that the Tracer writes the applied rules in order, and that
+// it chains to callbacks installed with NotifyOnMatchedRule and
+// NotifyOnAppliedRule.
+func TestTracer(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	cat := testcat.New()
+	if _, err := cat.ExecuteDDL("CREATE TABLE kv (k INT PRIMARY KEY, v INT, s STRING)"); err != nil {
+		t.Fatal(err)
+	}
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+
+	// build normalizes the query with a tracer of the given verbosity installed,
+	// and returns the trace along with the rules seen by the user callback.
+	build := func(
+		query string, verbosity norm.TraceVerbosity, matched norm.MatchedRuleFunc,
+	) (trace string, applied []opt.RuleName) {
+		stmt, err := parser.ParseOne(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		semaCtx := tree.MakeSemaContext()
+
+		var f norm.Factory
+		f.Init(&evalCtx, cat)
+		f.NotifyOnAppliedRule(func(ruleName opt.RuleName, source, target opt.Expr) {
+			applied = append(applied, ruleName)
+		})
+
+		var buf strings.Builder
+		f.SetTracer(&buf, verbosity)
+		if matched != nil {
+			// Installed after the tracer, so it must be chained by the tracer.
+			f.NotifyOnMatchedRule(matched)
+		}
+
+		b := optbuilder.New(context.Background(), &semaCtx, &evalCtx, cat, &f, stmt.AST)
+		if err := b.Build(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String(), applied
+	}
+
+	const query = "SELECT k FROM kv WHERE NOT (v = 1)"
+
+	t.Run("rule names", func(t *testing.T) {
+		trace, applied := build(query, norm.TraceRuleNames, nil /* matched */)
+
+		lines := strings.Split(strings.TrimSpace(trace), "\n")
+		if len(lines) != len(applied) {
+			t.Fatalf("expected trace to match applied rules %v, got:\n%s", applied, trace)
+		}
+		for i := range lines {
+			if lines[i] != applied[i].String() {
+				t.Fatalf("expected trace to match applied rules %v, got:\n%s", applied, trace)
+			}
+		}
+
+		// The expected rules must appear in order, though other rules may be
+		// interleaved.
+		expected := []opt.RuleName{opt.NegateComparison, opt.PruneSelectCols, opt.PruneScanCols}
+		i := 0
+		for _, line := range lines {
+			if i < len(expected) && line == expected[i].String() {
+				i++
+			}
+		}
+		if i != len(expected) {
+			t.Fatalf("expected rules %v in order, got:\n%s", expected, trace)
+		}
+	})
+
+	t.Run("exprs", func(t *testing.T) {
+		skipNegate := func(ruleName opt.RuleName) bool {
+			return ruleName != opt.NegateComparison
+		}
+		trace, applied := build(query, norm.TraceExprs, skipNegate)
+
+		if !strings.Contains(trace, "NegateComparison (skipped)\n") {
+			t.Fatalf("expected skipped NegateComparison in trace, got:\n%s", trace)
+		}
+		for _, rule := range applied {
+			if rule == opt.NegateComparison {
+				t.Fatalf("expected NegateComparison to be skipped, got %v", applied)
+			}
+		}
+		if !strings.Contains(trace, "PruneSelectCols\n  result:  (Project (Select (Scan kv) ") {
+			t.Fatalf("expected one-line result for PruneSelectCols, got:\n%s", trace)
+		}
+	})
+
+	t.Run("trees", func(t *testing.T) {
+		trace, _ := build(query, norm.TraceTrees, nil /* matched */)
+		if !strings.Contains(trace, "\n    select\n") {
+			t.Fatalf("expected full tree of select in trace, got:\n%s", trace)
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		var f norm.Factory
+		f.Init(&evalCtx, cat)
+		var applied []opt.RuleName
+		f.NotifyOnAppliedRule(func(ruleName opt.RuleName, source, target opt.Expr) {
+			applied = append(applied, ruleName)
+		})
+		var buf strings.Builder
+		f.SetTracer(&buf, norm.TraceRuleNames)
+		f.SetTracer(nil, norm.TraceRuleNames)
+
+		stmt, err := parser.ParseOne(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		semaCtx := tree.MakeSemaContext()
+		b := optbuilder.New(context.Background(), &semaCtx, &evalCtx, cat, &f, stmt.AST)
+		if err := b.Build(); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() != 0 {
+			t.Fatalf("expected no trace after removing tracer, got:\n%s", buf.String())
+		}
+		if len(applied) == 0 {
+			t.Fatal("expected user callback to be restored after removing tracer")
+		}
+	})
+}
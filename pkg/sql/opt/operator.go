@@ -50,6 +50,52 @@ func (op Operator) SyntaxTag() string {
 	}
 }
 
+// OperandKind describes the kind of an operand that is passed to the factory
+// in order to construct an operator, such as via Factory.DynamicConstruct.
+type OperandKind uint8
+
+const (
+	// RelationalOperand is a relational expression (memo.RelExpr).
+	RelationalOperand OperandKind = iota + 1
+
+	// ScalarOperand is a scalar expression (opt.ScalarExpr) that is not a list.
+	ScalarOperand
+
+	// ListOperand is a list expression, such as memo.FiltersExpr or
+	// memo.ScalarListExpr.
+	ListOperand
+
+	// PrivateOperand is operator-specific data that is not an expression, such
+	// as memo.ScanPrivate or opt.ColumnID.
+	PrivateOperand
+)
+
+// String returns the name of the operand kind as a string.
+func (k OperandKind) String() string {
+	switch k {
+	case RelationalOperand:
+		return "relational"
+	case ScalarOperand:
+		return "scalar"
+	case ListOperand:
+		return "list"
+	case PrivateOperand:
+		return "private"
+	}
+	return fmt.Sprintf("OperandKind(%d)", k)
+}
+
+// OperandKinds returns the kinds of the operands that are needed to construct
+// the given operator, in the order they are passed to the factory. It returns
+// nil if the operator cannot be constructed by the factory (e.g. list and
+// private operators).
+func OperandKinds(op Operator) []OperandKind {
+	if op >= NumOperators {
+		return nil
+	}
+	return opOperandKinds[op]
+}
+
 // Expr is a node in an expression tree. It offers methods to traverse and
 // inspect the tree. Each node in the tree has an enumerated operator type, zero
 // or more children, and an optional private value. The entire tree can be
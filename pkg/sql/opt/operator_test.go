@@ -56,3 +56,25 @@ func TestAggregateProperties(t *testing.T) {
 		}
 	}
 }
+
+// TestNegateOpMap verifies that every negatable operator is a comparison and
+// that negating it twice yields the original operator.
+func TestNegateOpMap(t *testing.T) {
+	isComparison := make(map[Operator]bool)
+	for _, op := range ComparisonOperators {
+		isComparison[op] = true
+	}
+
+	for op, negated := range NegateOpMap {
+		if !isComparison[op] {
+			t.Errorf("%s is not a comparison operator", op)
+		}
+		if op == negated {
+			t.Errorf("%s negates to itself", op)
+		}
+		if NegateOpMap[negated] != op {
+			t.Errorf("%s negates to %s, but %s negates to %s",
+				op, negated, negated, NegateOpMap[negated])
+		}
+	}
+}
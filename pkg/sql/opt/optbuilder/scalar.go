@@ -156,9 +156,12 @@ func (b *Builder) buildScalar(
 		// b.subquery.outerCols.
 		b.checkSubqueryOuterCols(s.outerCols, inGroupingContext, inScope, colRefs)
 
+		// ORDER BY may reference the same column more than once (e.g. ORDER BY
+		// x, x DESC), so canonicalize the ordering before storing it in the
+		// private; the memo expects orderings in privates to be canonical.
 		subqueryPrivate := memo.SubqueryPrivate{
 			OriginalExpr: s.Subquery,
-			Ordering:     s.ordering,
+			Ordering:     s.ordering.Canonicalize(),
 			RequestedCol: inCol,
 		}
 		out = b.factory.ConstructArrayFlatten(s.node, &subqueryPrivate)
@@ -646,6 +646,10 @@ func (g *exprsGen) genMemoizeFuncs() {
 		if !define.Tags.Contains("Scalar") {
 			fmt.Fprintf(g.w, "  m.logPropsBuilder.build%sProps(e, &grp.rel)\n", define.Name)
 			fmt.Fprintf(g.w, "  grp.rel.Populated = true\n")
+			fmt.Fprintf(g.w, "    m.stats.Groups++\n")
+			fmt.Fprintf(g.w, "    m.stats.RelExprs++\n")
+		} else {
+			fmt.Fprintf(g.w, "    m.stats.ScalarExprs++\n")
 		}
 		fmt.Fprintf(g.w, "    m.memEstimate += size\n")
 		fmt.Fprintf(g.w, "    m.CheckExpr(e)\n")
@@ -703,6 +707,7 @@ func (g *exprsGen) genAddToGroupFuncs() {
 			fmt.Fprintf(g.w, "    e.initUnexportedFields(m)\n")
 		}
 		fmt.Fprintf(g.w, "    e.setGroup(grp)\n")
+		fmt.Fprintf(g.w, "    m.stats.RelExprs++\n")
 		fmt.Fprintf(g.w, "    m.memEstimate += size\n")
 		fmt.Fprintf(g.w, "    m.CheckExpr(e)\n")
 		fmt.Fprintf(g.w, "  } else if interned.group() != grp.group() {\n")
@@ -463,6 +463,7 @@ func (g *factoryGen) genCopyAndReplaceDefault() {
 // similar to this:
 //
 //   func (f *Factory) DynamicConstruct(op opt.Operator, args ...interface{}) opt.Node {
+//     f.mem.CheckDynamicOperands(op, args)
 //     switch op {
 //     case opt.ProjectOp:
 //       return f.ConstructProject(
@@ -476,6 +477,7 @@ func (g *factoryGen) genCopyAndReplaceDefault() {
 //
 func (g *factoryGen) genDynamicConstruct() {
 	g.w.nestIndent("func (f *Factory) DynamicConstruct(op opt.Operator, args ...interface{}) opt.Expr {\n")
+	g.w.writeIndent("f.mem.CheckDynamicOperands(op, args)\n")
 	g.w.writeIndent("switch op {\n")
 
 	defines := g.compiled.Defines.
@@ -24,12 +24,14 @@ import (
 type opsGen struct {
 	compiled *lang.CompiledExpr
 	w        io.Writer
+	md       *metadata
 	sorted   lang.DefineSetExpr
 }
 
 func (g *opsGen) generate(compiled *lang.CompiledExpr, w io.Writer) {
 	g.compiled = compiled
 	g.w = w
+	g.md = newMetadata(compiled, "opt")
 	g.sorted = sortDefines(compiled.Defines)
 
 	fmt.Fprintf(g.w, "package opt\n\n")
@@ -37,6 +39,7 @@ func (g *opsGen) generate(compiled *lang.CompiledExpr, w io.Writer) {
 	g.genOperatorEnum()
 	g.genOperatorNames()
 	g.genOperatorSyntaxTags()
+	g.genOperandKinds()
 	g.genOperatorsByTag()
 }
 
@@ -87,6 +90,45 @@ func (g *opsGen) genOperatorSyntaxTags() {
 	fmt.Fprintf(g.w, "var opSyntaxTagIndexes = [...]uint32{%s%d}\n\n", indexes.String(), names.Len())
 }
 
+// genOperandKinds generates a table that maps each operator that can be
+// constructed by the factory to the kinds of its operands, in the order they
+// are passed to its Construct method. The code looks similar to this:
+//
+//   var opOperandKinds = [...][]OperandKind{
+//     ProjectOp: {RelationalOperand, ListOperand, PrivateOperand},
+//     ...
+//   }
+//
+func (g *opsGen) genOperandKinds() {
+	fmt.Fprintf(g.w, "var opOperandKinds = [NumOperators][]OperandKind{\n")
+	defines := g.sorted.
+		WithoutTag("Enforcer").
+		WithoutTag("List").
+		WithoutTag("Private")
+
+	for _, define := range defines {
+		fmt.Fprintf(g.w, "  %sOp: {", define.Name)
+		for i, field := range g.md.childAndPrivateFields(define) {
+			if i != 0 {
+				fmt.Fprintf(g.w, ", ")
+			}
+			typ := g.md.typeOf(field)
+			switch {
+			case !typ.isExpr:
+				fmt.Fprintf(g.w, "PrivateOperand")
+			case typ.isListType():
+				fmt.Fprintf(g.w, "ListOperand")
+			case typ.friendlyName == "RelExpr":
+				fmt.Fprintf(g.w, "RelationalOperand")
+			default:
+				fmt.Fprintf(g.w, "ScalarOperand")
+			}
+		}
+		fmt.Fprintf(g.w, "},\n")
+	}
+	fmt.Fprintf(g.w, "}\n\n")
+}
+
 func (g *opsGen) genOperatorsByTag() {
 	for _, tag := range g.compiled.DefineTags {
 		fmt.Fprintf(g.w, "var %sOperators = [...]Operator{\n", tag)
@@ -275,6 +275,9 @@ func (eg *exprGen) castToDesiredType(arg interface{}, desiredType reflect.Type)
 		if desiredType == reflect.TypeOf(memo.ScanLimit(0)) {
 			return memo.MakeScanLimit(int64(*i), false)
 		}
+		if desiredType == reflect.TypeOf(memo.TupleOrdinal(0)) {
+			return memo.TupleOrdinal(*i)
+		}
 	}
 
 	if str, ok := arg.(string); ok {
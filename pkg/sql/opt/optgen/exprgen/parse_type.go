@@ -22,12 +22,15 @@ import (
 
 // ParseType parses a string describing a type.
 // It supports tuples using the syntax "tuple{<type>, <type>, ...}" but does not
-// support tuples of tuples.
+// support tuples of tuples. Tuple elements can be labeled using the syntax
+// "tuple{<type> AS <label>, ...}"; either all or none of the elements must be
+// labeled.
 func ParseType(typeStr string) (*types.T, error) {
 	// Special case for tuples for which there is no SQL syntax.
 	if strings.HasPrefix(typeStr, "tuple{") && strings.HasSuffix(typeStr, "}") {
 		s := strings.TrimPrefix(typeStr, "tuple{")
 		s = strings.TrimSuffix(s, "}")
+		s, labels := extractTupleLabels(s)
 		// Hijack the PREPARE syntax which takes a list of types.
 		// TODO(radu): this won't work for tuples of tuples; we would need to add
 		// some special syntax.
@@ -40,6 +43,12 @@ func ParseType(typeStr string) (*types.T, error) {
 		for i := range colTypesRefs {
 			colTypes[i] = tree.MustBeStaticallyKnownType(colTypesRefs[i])
 		}
+		if labels != nil {
+			if len(labels) != len(colTypes) {
+				return nil, errors.Newf("cannot parse %s as a type: all elements must be labeled", typeStr)
+			}
+			return types.MakeLabeledTuple(colTypes, labels), nil
+		}
 		return types.MakeTuple(colTypes), nil
 	}
 	typ, err := parser.GetTypeFromValidSQLSyntax(typeStr)
@@ -48,3 +57,33 @@ func ParseType(typeStr string) (*types.T, error) {
 	}
 	return tree.MustBeStaticallyKnownType(typ), nil
 }
+
+// extractTupleLabels removes the " AS <label>" suffixes from a comma-separated
+// list of tuple element types and returns the remaining list of types along
+// with the labels. If no element is labeled, labels is nil.
+func extractTupleLabels(s string) (_ string, labels []string) {
+	var elems []string
+	depth, start := 0, 0
+	for i, ch := range s {
+		switch ch {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				elems = append(elems, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	elems = append(elems, s[start:])
+
+	for i := range elems {
+		if idx := strings.LastIndex(elems[i], " AS "); idx >= 0 {
+			labels = append(labels, strings.TrimSpace(elems[i][idx+len(" AS "):]))
+			elems[i] = elems[i][:idx]
+		}
+	}
+	return strings.Join(elems, ","), labels
+}
@@ -118,3 +118,41 @@ func (o Ordering) Equals(rhs Ordering) bool {
 	}
 	return true
 }
+
+// IsCanonical returns true if no column appears more than once in the
+// ordering. See Canonicalize.
+func (o Ordering) IsCanonical() bool {
+	var seen ColSet
+	for _, col := range o {
+		if seen.Contains(col.ID()) {
+			return false
+		}
+		seen.Add(col.ID())
+	}
+	return true
+}
+
+// Canonicalize returns an equivalent ordering in which each column appears at
+// most once. Once rows are sorted on a column, a later occurrence of that same
+// column cannot change their order, whether it has the same direction (a
+// duplicate) or the opposite direction (a contradiction). Therefore, only the
+// first occurrence of each column is kept. For example:
+//
+//   +1,-2,+1,+2  =>  +1,-2
+//
+// If the ordering is already canonical, it is returned as-is. Otherwise, a new
+// ordering is allocated, and the receiver is not modified.
+func (o Ordering) Canonicalize() Ordering {
+	if o.IsCanonical() {
+		return o
+	}
+	var seen ColSet
+	res := make(Ordering, 0, len(o)-1)
+	for _, col := range o {
+		if !seen.Contains(col.ID()) {
+			seen.Add(col.ID())
+			res = append(res, col)
+		}
+	}
+	return res
+}
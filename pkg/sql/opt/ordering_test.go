@@ -47,6 +47,42 @@ func TestOrdering(t *testing.T) {
 	}
 }
 
+func TestOrdering_Canonicalize(t *testing.T) {
+	testCases := []struct {
+		ordering  opt.Ordering
+		canonical bool
+		expected  string
+	}{
+		{ordering: opt.Ordering{}, canonical: true, expected: ""},
+		{ordering: opt.Ordering{1, -2, 3}, canonical: true, expected: "+1,-2,+3"},
+
+		// Duplicate columns are removed.
+		{ordering: opt.Ordering{1, 1}, canonical: false, expected: "+1"},
+		{ordering: opt.Ordering{-1, 2, -1, 2}, canonical: false, expected: "-1,+2"},
+
+		// Contradictory columns are removed; the first direction wins.
+		{ordering: opt.Ordering{1, -1}, canonical: false, expected: "+1"},
+		{ordering: opt.Ordering{-3, 2, 3}, canonical: false, expected: "-3,+2"},
+	}
+
+	for _, tc := range testCases {
+		before := tc.ordering.String()
+		if tc.ordering.IsCanonical() != tc.canonical {
+			t.Errorf("%s: expected IsCanonical=%v", before, tc.canonical)
+		}
+		res := tc.ordering.Canonicalize()
+		if res.String() != tc.expected {
+			t.Errorf("%s: expected %s, got %s", before, tc.expected, res.String())
+		}
+		if !res.IsCanonical() {
+			t.Errorf("%s: result %s is not canonical", before, res.String())
+		}
+		if tc.ordering.String() != before {
+			t.Errorf("%s: ordering was modified to %s", before, tc.ordering.String())
+		}
+	}
+}
+
 func TestOrderingColumn_RemapColumn(t *testing.T) {
 	var md opt.Metadata
 	catalog := testcat.New()
@@ -566,7 +566,7 @@ func (f *FuncDepSet) CopyFrom(fdset *FuncDepSet) {
 //   1     1     1
 //
 func (f *FuncDepSet) ColsAreStrictKey(cols opt.ColSet) bool {
-	return f.colsAreKey(cols, strictKey)
+	return f.colsAreKey(cols, opt.ColSet{} /* notNullCols */, strictKey)
 }
 
 // ColsAreLaxKey returns true if the given columns contain a lax key for the
@@ -588,7 +588,17 @@ func (f *FuncDepSet) ColsAreStrictKey(cols opt.ColSet) bool {
 //   1     1     1
 //
 func (f *FuncDepSet) ColsAreLaxKey(cols opt.ColSet) bool {
-	return f.colsAreKey(cols, laxKey)
+	return f.colsAreKey(cols, opt.ColSet{} /* notNullCols */, laxKey)
+}
+
+// ColsAreLaxKeyWithNotNull is similar to ColsAreLaxKey, except that it also
+// uses the given set of columns that are known to be not null in the relation.
+// A not-null column that is functionally determined by the given columns is
+// non-null whenever they are, so it can be used to reach a lax key. For
+// example, if (a,b) is a lax key, and ()-->(a), then (b) is a lax key as long as
+// the constant value of a is not NULL.
+func (f *FuncDepSet) ColsAreLaxKeyWithNotNull(cols, notNullCols opt.ColSet) bool {
+	return f.colsAreKey(cols, notNullCols, laxKey)
 }
 
 // ConstantCols returns the set of columns that will always have the same value
@@ -1641,7 +1651,15 @@ func (f FuncDepSet) formatFDs(b *strings.Builder) {
 
 // colsAreKey returns true if the given columns contain a strict or lax key for
 // the relation.
-func (f *FuncDepSet) colsAreKey(cols opt.ColSet, typ keyType) bool {
+func (f *FuncDepSet) colsAreKey(cols, notNullCols opt.ColSet, typ keyType) bool {
+	if typ == laxKey && !notNullCols.Empty() {
+		// Any not-null column in the strict closure of the given columns has the
+		// same value in two rows that have the same non-null values for the
+		// given columns, and is not NULL. It can therefore be treated as if it
+		// were one of the given columns when checking for a lax key.
+		cols = cols.Union(f.ComputeClosure(cols).Intersection(notNullCols))
+	}
+
 	switch f.hasKey {
 	case strictKey:
 		// Determine whether the key is in the closure of the given columns. The
@@ -1668,10 +1686,9 @@ func (f *FuncDepSet) colsAreKey(cols opt.ColSet, typ keyType) bool {
 		// key.
 		//
 		// We can however use the equivalent closure, because those columns are null
-		// only if one of the initial cols is null.
-		//
-		// Note: if we had information, we could use just the not-null columns from
-		// the strict closure.
+		// only if one of the initial cols is null. Not-null columns from the
+		// strict closure have already been added to cols above, if the caller
+		// provided not-null information.
 		return f.key.SubsetOf(f.ComputeEquivClosure(cols))
 
 	default:
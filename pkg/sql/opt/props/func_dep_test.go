@@ -75,6 +75,22 @@ func TestFuncDeps_ColsAreKey(t *testing.T) {
 		testColsAreStrictKey(t, &loj, tc.cols, tc.strict)
 		testColsAreLaxKey(t, &loj, tc.cols, tc.lax)
 	}
+
+	// When it is known that the constant column 3 is not null, (2,11) is a lax
+	// key.
+	testColsAreLaxKeyWithNotNull(t, &loj, c(2, 11), c(3), true)
+	testColsAreLaxKeyWithNotNull(t, &loj, c(2, 11), c(), false)
+	testColsAreLaxKeyWithNotNull(t, &loj, c(2, 11), c(4, 5), false)
+	testColsAreLaxKeyWithNotNull(t, &loj, c(2), c(3), false)
+
+	// Relation with only a lax key, where (2)-->(3).
+	var laxOnly props.FuncDepSet
+	laxOnly.AddLaxKey(c(1, 3), c(1, 2, 3))
+	laxOnly.AddSynthesizedCol(c(2), 3)
+	testColsAreLaxKey(t, &laxOnly, c(1, 2), false)
+	testColsAreLaxKeyWithNotNull(t, &laxOnly, c(1, 2), c(3), true)
+	testColsAreLaxKeyWithNotNull(t, &laxOnly, c(1, 2), c(1, 2), false)
+	testColsAreStrictKey(t, &laxOnly, c(1, 2), false)
 }
 
 func TestFuncDeps_ComputeClosure(t *testing.T) {
@@ -1344,6 +1360,20 @@ func testColsAreLaxKey(t *testing.T, f *props.FuncDepSet, cols opt.ColSet, expec
 	}
 }
 
+func testColsAreLaxKeyWithNotNull(
+	t *testing.T, f *props.FuncDepSet, cols, notNullCols opt.ColSet, expected bool,
+) {
+	t.Helper()
+	actual := f.ColsAreLaxKeyWithNotNull(cols, notNullCols)
+	if actual != expected {
+		if expected {
+			t.Errorf("%s is not a lax key for %s with not-null cols %s", cols, f, notNullCols)
+		} else {
+			t.Errorf("%s is a lax key for %s with not-null cols %s", cols, f, notNullCols)
+		}
+	}
+}
+
 func c(cols ...opt.ColumnID) opt.ColSet {
 	return opt.MakeColSet(cols...)
 }
@@ -10,6 +10,8 @@
 
 package opt
 
+import "github.com/cockroachdb/cockroach/pkg/util"
+
 // RuleName enumerates the names of all the optimizer rules. Manual rule names
 // are defined in this file and rule names generated by Optgen are defined in
 // rule_name.og.go.
@@ -41,8 +43,34 @@ func (r RuleName) IsExplore() bool {
 	return r > startExploreRule
 }
 
+// IsEssential returns true if r is a rule that must not be disabled when rules
+// are randomly disabled or declined for testing, because planning fails or
+// produces invalid results without it.
+func (r RuleName) IsEssential() bool {
+	return essentialRules.Contains(int(r))
+}
+
+var essentialRules = util.MakeFastIntSet(
+	// Needed to prevent constraint building from failing.
+	int(NormalizeInConst),
+	// Needed when an index is forced.
+	int(GenerateIndexScans),
+	// Needed to prevent "same fingerprint cannot map to different groups."
+	int(PruneJoinLeftCols),
+	int(PruneJoinRightCols),
+	// Needed to prevent stack overflow.
+	int(PushFilterIntoJoinLeftAndRight),
+	int(PruneSelectCols),
+	// Needed to prevent execbuilder error.
+	// TODO(radu): the DistinctOn execution path should be fixed up so it
+	// supports distinct on an empty column set.
+	int(EliminateDistinctNoColumns),
+	int(EliminateEnsureDistinctNoColumns),
+)
+
 // Make linter happy.
 var _ = InvalidRuleName
 var _ = NumManualRuleNames
 var _ = RuleName.IsNormalize
 var _ = RuleName.IsExplore
+var _ = RuleName.IsEssential
@@ -164,6 +164,12 @@ type TableMeta struct {
 	// the map.
 	partialIndexPredicates map[cat.IndexOrdinal]ScalarExpr
 
+	// indexCols caches the set of table columns in each index, indexed by index
+	// ordinal. It is populated when the table is added to the metadata, and is
+	// never modified afterwards, so it can be safely shared between copies of
+	// the metadata. See IndexColumns.
+	indexCols []ColSet
+
 	// anns annotates the table metadata with arbitrary data.
 	anns [maxTableAnnIDCount]interface{}
 }
@@ -177,8 +183,28 @@ func (tm *TableMeta) clearAnnotations() {
 }
 
 // IndexColumns returns the set of table columns in the given index.
-// TODO(justin): cache this value in the table metadata.
+//
+// The returned set is shared with all other callers, so it must not be
+// modified in place. Callers that need a modified set should use Copy or a
+// non-mutating operation such as Intersection instead.
 func (tm *TableMeta) IndexColumns(indexOrd int) ColSet {
+	if indexOrd < len(tm.indexCols) {
+		return tm.indexCols[indexOrd]
+	}
+	return tm.makeIndexColumns(indexOrd)
+}
+
+// cacheIndexColumns computes the set of table columns in each index of the
+// table and caches it for use by IndexColumns.
+func (tm *TableMeta) cacheIndexColumns() {
+	tm.indexCols = make([]ColSet, tm.Table.DeletableIndexCount())
+	for i := range tm.indexCols {
+		tm.indexCols[i] = tm.makeIndexColumns(i)
+	}
+}
+
+// makeIndexColumns returns a new set of the table columns in the given index.
+func (tm *TableMeta) makeIndexColumns(indexOrd int) ColSet {
 	index := tm.Table.Index(indexOrd)
 
 	var indexCols ColSet
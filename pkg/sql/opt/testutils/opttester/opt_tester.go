@@ -208,6 +208,14 @@ type Flags struct {
 	// stable operators.
 	NoStableFolds bool
 
+	// HoistCommonFilterExprs enables the HoistCommonFilterExprs normalization
+	// rule, which is disabled by default.
+	HoistCommonFilterExprs bool
+
+	// HoistCommonProjectionExprs enables the HoistCommonProjectionExprs
+	// normalization rule, which is disabled by default.
+	HoistCommonProjectionExprs bool
+
 	// IndexVersion controls the version of the index descriptor created in the
 	// test catalog. This field is only used by the exec-ddl command for CREATE
 	// INDEX statements.
@@ -388,6 +396,12 @@ func New(catalog cat.Catalog, sql string) *OptTester {
 //  - no-stable-folds: disallows constant folding for stable operators; only
 //                     used with "norm".
 //
+//  - hoist-common-filter-exprs: enables the HoistCommonFilterExprs rule,
+//    which is disabled by default.
+//
+//  - hoist-common-projection-exprs: enables the HoistCommonProjectionExprs
+//    rule, which is disabled by default.
+//
 //  - fully-qualify-names: fully qualify all column names in the test output.
 //
 //  - expect: fail the test if the rules specified by name are not "applied".
@@ -804,6 +818,12 @@ func (f *Flags) Set(arg datadriven.CmdArg) error {
 	case "no-stable-folds":
 		f.NoStableFolds = true
 
+	case "hoist-common-filter-exprs":
+		f.HoistCommonFilterExprs = true
+
+	case "hoist-common-projection-exprs":
+		f.HoistCommonProjectionExprs = true
+
 	case "disable":
 		if len(arg.Vals) == 0 {
 			return fmt.Errorf("disable requires arguments")
@@ -1883,6 +1903,12 @@ func (ot *OptTester) buildExpr(factory *norm.Factory) error {
 func (ot *OptTester) makeOptimizer() *xform.Optimizer {
 	var o xform.Optimizer
 	o.Init(&ot.evalCtx, ot.catalog)
+	if ot.Flags.HoistCommonFilterExprs {
+		o.Factory().EnableCommonFilterExprHoisting()
+	}
+	if ot.Flags.HoistCommonProjectionExprs {
+		o.Factory().EnableCommonProjectionExprHoisting()
+	}
 	o.NotifyOnAppliedRule(func(ruleName opt.RuleName, source, target opt.Expr) {
 		// Exploration rules are marked as "applied" if they generate one or
 		// more new expressions.
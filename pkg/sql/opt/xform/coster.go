@@ -997,10 +997,8 @@ func (c *coster) computeZigzagJoinCost(join *memo.ZigzagJoinExpr) memo.Cost {
 	// with each side's IndexColumns. Columns present in both indexes are
 	// projected from the left side only.
 	md := c.mem.Metadata()
-	leftCols := md.TableMeta(join.LeftTable).IndexColumns(join.LeftIndex)
-	leftCols.IntersectionWith(join.Cols)
-	rightCols := md.TableMeta(join.RightTable).IndexColumns(join.RightIndex)
-	rightCols.IntersectionWith(join.Cols)
+	leftCols := md.TableMeta(join.LeftTable).IndexColumns(join.LeftIndex).Intersection(join.Cols)
+	rightCols := md.TableMeta(join.RightTable).IndexColumns(join.RightIndex).Intersection(join.Cols)
 	rightCols.DifferenceWith(leftCols)
 	scanCost := c.rowScanCost(join.LeftTable, join.LeftIndex, leftCols.Len())
 	scanCost += c.rowScanCost(join.RightTable, join.RightIndex, rightCols.Len())
@@ -37,6 +37,17 @@ type MatchedRuleFunc = norm.MatchedRuleFunc
 // details.
 type AppliedRuleFunc = norm.AppliedRuleFunc
 
+// GroupExpansionFunc defines the callback function for the
+// NotifyOnGroupExpansion event supported by the optimizer. It is invoked each
+// time an exploration rule has been applied. The function is called with the
+// name of the rule, the first member of the memo group that the rule matched,
+// and the number of expressions in that group before and after the rule was
+// applied. If the rule did not add any expressions to the group (e.g. because
+// they were already part of the memo), then before and after are equal. The new
+// expressions, if any, are the group members following the first "before"
+// members.
+type GroupExpansionFunc func(ruleName opt.RuleName, group memo.RelExpr, before, after int)
+
 // RuleSet efficiently stores an unordered set of RuleNames.
 type RuleSet = util.FastIntSet
 
@@ -88,9 +99,18 @@ type Optimizer struct {
 
 	// appliedRule is the callback function which is invoked each time an
 	// optimization rule (Normalize or Explore) has been applied by the optimizer.
-	// It can be set via a call to the NotifyOnAppliedRule method.
+	// It is nil unless NotifyOnAppliedRule or NotifyOnGroupExpansion has been
+	// called. See updateAppliedRule.
 	appliedRule AppliedRuleFunc
 
+	// notifyAppliedRule is the callback function set via a call to the
+	// NotifyOnAppliedRule method.
+	notifyAppliedRule AppliedRuleFunc
+
+	// groupExpansion is the callback function set via a call to the
+	// NotifyOnGroupExpansion method.
+	groupExpansion GroupExpansionFunc
+
 	// disabledRules is a set of rules that are not allowed to run, used for
 	// testing.
 	disabledRules RuleSet
@@ -180,13 +200,60 @@ func (o *Optimizer) NotifyOnMatchedRule(matchedRule MatchedRuleFunc) {
 // optimization rule (Normalize or Explore) has been applied by the optimizer.
 // If appliedRule is nil, then no further notifications are sent.
 func (o *Optimizer) NotifyOnAppliedRule(appliedRule AppliedRuleFunc) {
-	o.appliedRule = appliedRule
+	o.notifyAppliedRule = appliedRule
+	o.updateAppliedRule()
 
 	// Also pass through the call to the factory so that normalization rules
 	// make same callback.
 	o.f.NotifyOnAppliedRule(appliedRule)
 }
 
+// NotifyOnGroupExpansion sets a callback function which is invoked each time an
+// exploration rule has been applied by the optimizer, reporting how many
+// expressions the rule added to the matched memo group. This can be used to
+// attribute memo growth to specific rules. If groupExpansion is nil, then no
+// further notifications are sent.
+func (o *Optimizer) NotifyOnGroupExpansion(groupExpansion GroupExpansionFunc) {
+	o.groupExpansion = groupExpansion
+	o.updateAppliedRule()
+}
+
+// updateAppliedRule sets the appliedRule callback invoked by the explorer and
+// the optimizer. It is nil if neither NotifyOnAppliedRule nor
+// NotifyOnGroupExpansion have set a callback, so that rules do not incur any
+// bookkeeping overhead by default.
+func (o *Optimizer) updateAppliedRule() {
+	if o.groupExpansion == nil {
+		o.appliedRule = o.notifyAppliedRule
+		return
+	}
+
+	o.appliedRule = func(ruleName opt.RuleName, source, target opt.Expr) {
+		if o.notifyAppliedRule != nil {
+			o.notifyAppliedRule(ruleName, source, target)
+		}
+
+		// Only exploration rules add expressions to the group of the expression
+		// they matched, which is passed as the source. The target is the first of
+		// the added expressions, which are always at the end of the group.
+		if source == nil {
+			return
+		}
+		grp := source.(memo.RelExpr).FirstExpr()
+		after := 0
+		for e := grp; e != nil; e = e.NextExpr() {
+			after++
+		}
+		added := 0
+		if target != nil {
+			for e := target.(memo.RelExpr); e != nil; e = e.NextExpr() {
+				added++
+			}
+		}
+		o.groupExpansion(ruleName, grp, after-added, after)
+	}
+}
+
 // Memo returns the memo structure that the optimizer is using to optimize.
 func (o *Optimizer) Memo() *memo.Memo {
 	return o.mem
@@ -904,26 +971,8 @@ func (a *groupStateAlloc) allocate() *groupState {
 
 // disableRules disables rules with the given probability for testing.
 func (o *Optimizer) disableRules(probability float64) {
-	essentialRules := util.MakeFastIntSet(
-		// Needed to prevent constraint building from failing.
-		int(opt.NormalizeInConst),
-		// Needed when an index is forced.
-		int(opt.GenerateIndexScans),
-		// Needed to prevent "same fingerprint cannot map to different groups."
-		int(opt.PruneJoinLeftCols),
-		int(opt.PruneJoinRightCols),
-		// Needed to prevent stack overflow.
-		int(opt.PushFilterIntoJoinLeftAndRight),
-		int(opt.PruneSelectCols),
-		// Needed to prevent execbuilder error.
-		// TODO(radu): the DistinctOn execution path should be fixed up so it
-		// supports distinct on an empty column set.
-		int(opt.EliminateDistinctNoColumns),
-		int(opt.EliminateEnsureDistinctNoColumns),
-	)
-
 	for i := opt.RuleName(1); i < opt.NumRuleNames; i++ {
-		if rand.Float64() < probability && !essentialRules.Contains(int(i)) {
+		if rand.Float64() < probability && !i.IsEssential() {
 			o.disabledRules.Add(int(i))
 		}
 	}
@@ -130,6 +130,63 @@ func TestDetachMemoRace(t *testing.T) {
 	wg.Wait()
 }
 
+// TestNotifyOnGroupExpansion tests that the group expansion callback reports
+// the number of expressions in a group before and after an exploration rule
+// adds expressions to it.
+func TestNotifyOnGroupExpansion(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	catalog := testcat.New()
+	if _, err := catalog.ExecuteDDL("CREATE TABLE abc (a INT PRIMARY KEY, b INT, c STRING, INDEX (c))"); err != nil {
+		t.Fatal(err)
+	}
+
+	var o xform.Optimizer
+	evalCtx := tree.MakeTestingEvalContext(cluster.MakeTestingClusterSettings())
+	testutils.BuildQuery(t, &o, catalog, &evalCtx, "SELECT c FROM abc")
+
+	applied := 0
+	o.NotifyOnAppliedRule(func(ruleName opt.RuleName, source, target opt.Expr) {
+		if ruleName == opt.GenerateIndexScans {
+			applied++
+		}
+	})
+	expansions := 0
+	o.NotifyOnGroupExpansion(func(ruleName opt.RuleName, group memo.RelExpr, before, after int) {
+		if after < before {
+			t.Errorf("%s: group shrank from %d to %d expressions", ruleName, before, after)
+		}
+		if group.FirstExpr() != group {
+			t.Errorf("%s: expected the first member of the group", ruleName)
+		}
+		if ruleName != opt.GenerateIndexScans {
+			return
+		}
+		expansions++
+
+		// GenerateIndexScans adds a scan over the secondary index on c to the
+		// group containing the primary index scan.
+		if before != 1 || after != 2 {
+			t.Errorf("expected GenerateIndexScans to expand group from 1 to 2 expressions, got %d to %d", before, after)
+		}
+		if scan, ok := group.NextExpr().(*memo.ScanExpr); !ok || scan.Index == 0 {
+			t.Errorf("expected secondary index scan to be added, got %v", group.NextExpr())
+		}
+	})
+
+	if _, err := o.Optimize(); err != nil {
+		t.Fatal(err)
+	}
+
+	if expansions != 1 {
+		t.Errorf("expected GenerateIndexScans group expansion to be reported once, got %d", expansions)
+	}
+	if applied != expansions {
+		t.Errorf("expected applied rule callback to still be invoked, got %d calls", applied)
+	}
+}
+
 // TestCoster files can be run separately like this:
 //   make test PKG=./pkg/sql/opt/xform TESTS="TestCoster/sort"
 //   make test PKG=./pkg/sql/opt/xform TESTS="TestCoster/scan"
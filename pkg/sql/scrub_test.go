@@ -326,90 +326,107 @@ INSERT INTO t.test VALUES (10, 20, 1337);
 // TestScrubCheckConstraint tests that `SCRUB TABLE ... CONSTRAINT ALL`
 // will fail if a check constraint is violated. To test this, a row's
 // underlying value is updated using the KV client so the row violates
-// the constraint..
+// the constraint. The constraint is tested on both a nullable and a NOT
+// NULL column, since the optimizer only treats check constraints on NOT
+// NULL columns as known to hold, and must not use them to skip the scan.
 func TestScrubCheckConstraint(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	defer log.Scope(t).Close(t)
 	s, db, kvDB := serverutils.StartServer(t, base.TestServerArgs{})
 	defer s.Stopper().Stop(context.Background())
 
-	// Create the table and the row entry.
-	if _, err := db.Exec(`
-CREATE DATABASE t;
-CREATE TABLE t.test (k INT PRIMARY KEY, v INT, CHECK (v > 1));
-INSERT INTO t.test VALUES (10, 2);
-`); err != nil {
-		t.Fatalf("unexpected error: %s", err)
-	}
-
-	tableDesc := catalogkv.TestingGetTableDescriptor(kvDB, keys.SystemSQLCodec, "t", "test")
-
-	var colIDtoRowIndex catalog.TableColMap
-	colIDtoRowIndex.Set(tableDesc.PublicColumns()[0].GetID(), 0)
-	colIDtoRowIndex.Set(tableDesc.PublicColumns()[1].GetID(), 1)
-
-	// Create the primary index key.
-	values := []tree.Datum{tree.NewDInt(10), tree.NewDInt(2)}
-	primaryIndexKeyPrefix := rowenc.MakeIndexKeyPrefix(
-		keys.SystemSQLCodec, tableDesc, tableDesc.GetPrimaryIndexID())
-	primaryIndexKey, _, err := rowenc.EncodeIndexKey(
-		tableDesc, tableDesc.GetPrimaryIndex(), colIDtoRowIndex, values, primaryIndexKeyPrefix)
-	if err != nil {
-		t.Fatalf("unexpected error: %s", err)
-	}
-
-	// Add the family suffix to the key.
-	family := tableDesc.GetFamilies()[0]
-	primaryIndexKey = keys.MakeFamilyKey(primaryIndexKey, uint32(family.ID))
-
-	// Generate a k/v that has a different value that violates the
-	// constraint.
-	values = []tree.Datum{tree.NewDInt(10), tree.NewDInt(0)}
-	// Encode the column value.
-	valueBuf, err := rowenc.EncodeTableValue(
-		[]byte(nil), tableDesc.PublicColumns()[1].GetID(), values[1], []byte(nil))
-	if err != nil {
-		t.Fatalf("unexpected error: %s", err)
-	}
-	// Construct the tuple for the family value.
-	var value roachpb.Value
-	value.SetTuple(valueBuf)
-
-	// Overwrite the existing value.
-	if err := kvDB.Put(context.Background(), primaryIndexKey, &value); err != nil {
-		t.Fatalf("unexpected error: %s", err)
-	}
-	// Run SCRUB and find the CHECK violation created.
-	rows, err := db.Query(`EXPERIMENTAL SCRUB TABLE t.test WITH OPTIONS CONSTRAINT ALL`)
-	if err != nil {
-		t.Fatalf("unexpected error: %s", err)
-	}
-	defer rows.Close()
-	results, err := sqlutils.GetScrubResultRows(rows)
-	if err != nil {
+	if _, err := db.Exec(`CREATE DATABASE t`); err != nil {
 		t.Fatalf("unexpected error: %s", err)
 	}
 
-	if len(results) != 1 {
-		t.Fatalf("expected 1 result, got %d. got %#v", len(results), results)
-	}
-
-	if result := results[0]; result.ErrorType != string(scrub.CheckConstraintViolation) {
-		t.Fatalf("expected %q error, instead got: %s",
-			scrub.CheckConstraintViolation, result.ErrorType)
-	} else if result.Database != "t" {
-		t.Fatalf("expected database %q, got %q", "t", result.Database)
-	} else if result.Table != "test" {
-		t.Fatalf("expected table %q, got %q", "test", result.Table)
-	} else if result.PrimaryKey != "(10)" {
-		t.Fatalf("expected primaryKey %q, got %q", "(10)", result.PrimaryKey)
-	} else if result.Repaired {
-		t.Fatalf("expected repaired %v, got %v", false, result.Repaired)
-	} else if !strings.Contains(result.Details,
-		`{"constraint_name": "check_v", "row_data": {"k": "10", "v": "0"}}`) {
-		t.Fatalf("expected error details to contain `%s`, got %s",
-			`{"constraint_name": "check_v", "row_data": {"k": "10", "v": "0"}}`,
-			result.Details)
+	for _, tc := range []struct {
+		table string
+		vCol  string
+	}{
+		{table: "test", vCol: "v INT"},
+		{table: "test_not_null", vCol: "v INT NOT NULL"},
+	} {
+		t.Run(tc.table, func(t *testing.T) {
+			// Create the table and the row entry.
+			if _, err := db.Exec(fmt.Sprintf(`
+CREATE TABLE t.%[1]s (k INT PRIMARY KEY, %[2]s, CHECK (v > 1));
+INSERT INTO t.%[1]s VALUES (10, 2);
+`, tc.table, tc.vCol)); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			tableDesc := catalogkv.TestingGetTableDescriptor(kvDB, keys.SystemSQLCodec, "t", tc.table)
+
+			var colIDtoRowIndex catalog.TableColMap
+			colIDtoRowIndex.Set(tableDesc.PublicColumns()[0].GetID(), 0)
+			colIDtoRowIndex.Set(tableDesc.PublicColumns()[1].GetID(), 1)
+
+			// Create the primary index key.
+			values := []tree.Datum{tree.NewDInt(10), tree.NewDInt(2)}
+			primaryIndexKeyPrefix := rowenc.MakeIndexKeyPrefix(
+				keys.SystemSQLCodec, tableDesc, tableDesc.GetPrimaryIndexID())
+			primaryIndexKey, _, err := rowenc.EncodeIndexKey(
+				tableDesc, tableDesc.GetPrimaryIndex(), colIDtoRowIndex, values, primaryIndexKeyPrefix)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			// Add the family suffix to the key.
+			family := tableDesc.GetFamilies()[0]
+			primaryIndexKey = keys.MakeFamilyKey(primaryIndexKey, uint32(family.ID))
+
+			// Generate a k/v that has a different value that violates the
+			// constraint.
+			values = []tree.Datum{tree.NewDInt(10), tree.NewDInt(0)}
+			// Encode the column value.
+			valueBuf, err := rowenc.EncodeTableValue(
+				[]byte(nil), tableDesc.PublicColumns()[1].GetID(), values[1], []byte(nil))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			// Construct the tuple for the family value.
+			var value roachpb.Value
+			value.SetTuple(valueBuf)
+
+			// Overwrite the existing value.
+			if err := kvDB.Put(context.Background(), primaryIndexKey, &value); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			// Run SCRUB and find the CHECK violation created.
+			rows, err := db.Query(fmt.Sprintf(
+				`EXPERIMENTAL SCRUB TABLE t.%s WITH OPTIONS CONSTRAINT ALL`, tc.table,
+			))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			defer rows.Close()
+			results, err := sqlutils.GetScrubResultRows(rows)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if len(results) != 1 {
+				t.Fatalf("expected 1 result, got %d. got %#v", len(results), results)
+			}
+
+			if result := results[0]; result.ErrorType != string(scrub.CheckConstraintViolation) {
+				t.Fatalf("expected %q error, instead got: %s",
+					scrub.CheckConstraintViolation, result.ErrorType)
+			} else if result.Database != "t" {
+				t.Fatalf("expected database %q, got %q", "t", result.Database)
+			} else if result.Table != tc.table {
+				t.Fatalf("expected table %q, got %q", tc.table, result.Table)
+			} else if result.PrimaryKey != "(10)" {
+				t.Fatalf("expected primaryKey %q, got %q", "(10)", result.PrimaryKey)
+			} else if result.Repaired {
+				t.Fatalf("expected repaired %v, got %v", false, result.Repaired)
+			} else if !strings.Contains(result.Details,
+				`{"constraint_name": "check_v", "row_data": {"k": "10", "v": "0"}}`) {
+				t.Fatalf("expected error details to contain `%s`, got %s",
+					`{"constraint_name": "check_v", "row_data": {"k": "10", "v": "0"}}`,
+					result.Details)
+			}
+		})
 	}
 }
 